@@ -0,0 +1,287 @@
+// Package cache stores upstream completions keyed by request content, so a
+// repeated (or, in semantic mode, similar) request can be served without a
+// round trip to the backend.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// Config is the cache: config.yaml block.
+type Config struct {
+	Backend                 string  `yaml:"backend"` // "memory" (default) or "file"; "redis" is not yet implemented
+	Path                    string  `yaml:"path,omitempty"`
+	TTLSeconds              int     `yaml:"ttl"`
+	Mode                    string  `yaml:"mode"` // "exact" or "semantic"; the proxy leaves caching off when mode is empty
+	EmbeddingModel          string  `yaml:"embedding_model,omitempty"`
+	SimilarityThreshold     float64 `yaml:"similarity_threshold,omitempty"`
+	IncludeNondeterministic bool    `yaml:"include_nondeterministic,omitempty"`
+}
+
+// Entry is one cached completion.
+type Entry struct {
+	Response  []byte    `json:"response"`
+	Embedding []float32 `json:"embedding,omitempty"`
+	StoredAt  time.Time `json:"stored_at"`
+}
+
+// Store persists cache entries behind an exact-match key, and additionally
+// supports a similarity scan over embeddings for semantic mode.
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Put(key string, entry *Entry) error
+	// Nearest returns the closest entry to embedding by cosine similarity,
+	// if any scores at or above threshold.
+	Nearest(embedding []float32, threshold float64) (*Entry, bool)
+}
+
+// EmbeddingProvider computes an embedding vector for a piece of text, by
+// calling an embedding deployment configured like any other model entry.
+type EmbeddingProvider interface {
+	Embed(text string) ([]float32, error)
+}
+
+// CanonicalKey hashes the parts of a request that determine its completion
+// (model, messages, temperature, tools) into a stable SHA-256 digest, so
+// requests that differ only in whitespace or in the order of their
+// top-level fields still hit the same entry. Key order inside messages and
+// tools is hashed as sent.
+func CanonicalKey(body []byte) string {
+	canon := struct {
+		Model       string          `json:"model"`
+		Messages    json.RawMessage `json:"messages,omitempty"`
+		Temperature float64         `json:"temperature"`
+		Tools       json.RawMessage `json:"tools,omitempty"`
+	}{
+		Model:       gjson.GetBytes(body, "model").String(),
+		Temperature: gjson.GetBytes(body, "temperature").Float(),
+	}
+	if raw := gjson.GetBytes(body, "messages").Raw; raw != "" {
+		canon.Messages = json.RawMessage(raw)
+	}
+	if raw := gjson.GetBytes(body, "tools").Raw; raw != "" {
+		canon.Tools = json.RawMessage(raw)
+	}
+
+	data, _ := json.Marshal(canon)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Bypass reports whether a request should skip the cache entirely: it asks
+// for tool_choice:"required" or a nonzero temperature, and cfg doesn't opt
+// into caching those nondeterministic requests anyway.
+func Bypass(cfg Config, body []byte) bool {
+	if cfg.IncludeNondeterministic {
+		return false
+	}
+	if gjson.GetBytes(body, "tool_choice").String() == "required" {
+		return true
+	}
+	return gjson.GetBytes(body, "temperature").Float() != 0
+}
+
+// LastUserMessage returns the content of the last "user" role message in
+// body, the text semantic mode embeds and matches on.
+func LastUserMessage(body []byte) string {
+	var last string
+	for _, m := range gjson.GetBytes(body, "messages").Array() {
+		if m.Get("role").String() == "user" {
+			last = m.Get("content").String()
+		}
+	}
+	return last
+}
+
+// Cache is the lookup/store API the proxy uses, dispatching to exact or
+// semantic matching per its Config.
+type Cache struct {
+	cfg      Config
+	store    Store
+	embedder EmbeddingProvider
+}
+
+// New ties a Store and, for semantic mode, an EmbeddingProvider together
+// behind cfg's matching mode.
+func New(cfg Config, store Store, embedder EmbeddingProvider) *Cache {
+	return &Cache{cfg: cfg, store: store, embedder: embedder}
+}
+
+// Bypass reports whether body's request should skip the cache entirely,
+// per this Cache's config.
+func (c *Cache) Bypass(body []byte) bool {
+	return Bypass(c.cfg, body)
+}
+
+// Lookup returns a cached response for body, if cfg's matching mode finds
+// one.
+func (c *Cache) Lookup(body []byte) (*Entry, bool) {
+	if c.cfg.Mode == "semantic" && c.embedder != nil {
+		msg := LastUserMessage(body)
+		if msg == "" {
+			return nil, false
+		}
+		embedding, err := c.embedder.Embed(msg)
+		if err != nil {
+			return nil, false
+		}
+		return c.store.Nearest(embedding, c.cfg.SimilarityThreshold)
+	}
+	return c.store.Get(CanonicalKey(body))
+}
+
+// Store saves response against body's request, embedding its last user
+// message first when cfg.Mode is "semantic".
+func (c *Cache) Store(body, response []byte) {
+	entry := &Entry{Response: response, StoredAt: time.Now()}
+	if c.cfg.Mode == "semantic" && c.embedder != nil {
+		if msg := LastUserMessage(body); msg != "" {
+			if embedding, err := c.embedder.Embed(msg); err == nil {
+				entry.Embedding = embedding
+			}
+		}
+	}
+	c.store.Put(CanonicalKey(body), entry)
+}
+
+// MemoryStore is an in-memory Store; restarting the process empties it.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]*Entry
+}
+
+// NewMemoryStore returns an empty in-memory Store. A zero ttl means
+// entries never expire.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, entries: make(map[string]*Entry)}
+}
+
+func (s *MemoryStore) Get(key string) (*Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.entries[key]
+	if !ok || s.expired(e) {
+		return nil, false
+	}
+	return e, true
+}
+
+func (s *MemoryStore) Put(key string, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *MemoryStore) Nearest(embedding []float32, threshold float64) (*Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var best *Entry
+	bestScore := -1.0
+	for _, e := range s.entries {
+		if len(e.Embedding) == 0 || s.expired(e) {
+			continue
+		}
+		if score := cosineSimilarity(embedding, e.Embedding); score > bestScore {
+			bestScore, best = score, e
+		}
+	}
+	if best == nil || bestScore < threshold {
+		return nil, false
+	}
+	return best, true
+}
+
+func (s *MemoryStore) expired(e *Entry) bool {
+	return s.ttl > 0 && time.Since(e.StoredAt) > s.ttl
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return -1
+	}
+	var dot, magA, magB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		magA += float64(a[i]) * float64(a[i])
+		magB += float64(b[i]) * float64(b[i])
+	}
+	if magA == 0 || magB == 0 {
+		return -1
+	}
+	return dot / (math.Sqrt(magA) * math.Sqrt(magB))
+}
+
+// fileSnapshot is the on-disk representation a FileStore persists.
+type fileSnapshot struct {
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// FileStore is a Store backed by an in-memory MemoryStore that is
+// snapshotted to a JSON file on every write, so cached entries survive a
+// restart.
+type FileStore struct {
+	*MemoryStore
+	path      string
+	writeLock sync.Mutex
+}
+
+// NewFileStore loads path if it exists, or starts empty, and returns a
+// Store that persists every write back to path.
+func NewFileStore(path string, ttl time.Duration) (*FileStore, error) {
+	fs := &FileStore{MemoryStore: NewMemoryStore(ttl), path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fs, nil
+		}
+		return nil, fmt.Errorf("cache: read store file: %w", err)
+	}
+
+	var snap fileSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("cache: decode store file: %w", err)
+	}
+	for key, e := range snap.Entries {
+		fs.MemoryStore.entries[key] = e
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Put(key string, entry *Entry) error {
+	if err := fs.MemoryStore.Put(key, entry); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+func (fs *FileStore) persist() error {
+	fs.writeLock.Lock()
+	defer fs.writeLock.Unlock()
+
+	fs.MemoryStore.mu.RLock()
+	snap := fileSnapshot{Entries: make(map[string]*Entry, len(fs.MemoryStore.entries))}
+	for key, e := range fs.MemoryStore.entries {
+		snap.Entries[key] = e
+	}
+	fs.MemoryStore.mu.RUnlock()
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cache: encode store file: %w", err)
+	}
+	return os.WriteFile(fs.path, data, 0o600)
+}
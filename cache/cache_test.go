@@ -0,0 +1,111 @@
+package cache
+
+import "testing"
+
+func TestCanonicalKeyStableUnderFieldOrder(t *testing.T) {
+	a := []byte(`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`)
+	b := []byte(`{"messages":[{"role":"user","content":"hi"}],"model":"gpt-4o","temperature":0}`)
+
+	if CanonicalKey(a) != CanonicalKey(b) {
+		t.Error("CanonicalKey should be stable under top-level field reordering")
+	}
+}
+
+func TestCanonicalKeyDiffersOnMessages(t *testing.T) {
+	a := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	b := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"bye"}]}`)
+
+	if CanonicalKey(a) == CanonicalKey(b) {
+		t.Error("CanonicalKey should differ when messages differ")
+	}
+}
+
+func TestBypassNondeterministic(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  Config
+		body string
+		want bool
+	}{
+		{"tool_choice required bypasses", Config{}, `{"tool_choice":"required"}`, true},
+		{"nonzero temperature bypasses", Config{}, `{"temperature":0.7}`, true},
+		{"zero temperature does not bypass", Config{}, `{"temperature":0}`, false},
+		{"include_nondeterministic overrides nonzero temperature", Config{IncludeNondeterministic: true}, `{"temperature":0.7}`, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Bypass(c.cfg, []byte(c.body)); got != c.want {
+				t.Errorf("Bypass() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreExactMatch(t *testing.T) {
+	store := NewMemoryStore(0)
+	key := CanonicalKey([]byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+
+	if _, hit := store.Get(key); hit {
+		t.Fatal("expected miss before any Put")
+	}
+
+	entry := &Entry{Response: []byte(`{"ok":true}`)}
+	if err := store.Put(key, entry); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, hit := store.Get(key)
+	if !hit {
+		t.Fatal("expected hit after Put")
+	}
+	if string(got.Response) != string(entry.Response) {
+		t.Errorf("Response = %s, want %s", got.Response, entry.Response)
+	}
+}
+
+func TestMemoryStoreNearestRespectsThreshold(t *testing.T) {
+	store := NewMemoryStore(0)
+	store.Put("a", &Entry{Response: []byte("a"), Embedding: []float32{1, 0}})
+	store.Put("b", &Entry{Response: []byte("b"), Embedding: []float32{0, 1}})
+
+	entry, hit := store.Nearest([]float32{1, 0}, 0.9)
+	if !hit {
+		t.Fatal("expected a hit for an identical embedding")
+	}
+	if string(entry.Response) != "a" {
+		t.Errorf("Nearest returned %s, want a", entry.Response)
+	}
+
+	if _, hit := store.Nearest([]float32{0, 1}, 0.99); !hit {
+		t.Fatal("expected a hit for an identical embedding at a strict threshold")
+	}
+	if _, hit := store.Nearest([]float32{0.6, 0.8}, 0.95); hit {
+		t.Error("expected no hit when nothing clears the similarity threshold")
+	}
+}
+
+type stubEmbedder struct {
+	vec []float32
+}
+
+func (s stubEmbedder) Embed(string) ([]float32, error) {
+	return s.vec, nil
+}
+
+func TestCacheSemanticLookup(t *testing.T) {
+	cfg := Config{Mode: "semantic", EmbeddingModel: "embed-1", SimilarityThreshold: 0.9}
+	c := New(cfg, NewMemoryStore(0), stubEmbedder{vec: []float32{1, 0}})
+
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"what's the weather"}]}`)
+	c.Store(body, []byte(`{"answer":"sunny"}`))
+
+	similar := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"what is the weather like"}]}`)
+	entry, hit := c.Lookup(similar)
+	if !hit {
+		t.Fatal("expected a semantic hit for a similar embedding")
+	}
+	if string(entry.Response) != `{"answer":"sunny"}` {
+		t.Errorf("Response = %s, want cached answer", entry.Response)
+	}
+}
@@ -3,36 +3,80 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/phosae/llmp/cache"
+	"github.com/phosae/llmp/metrics"
+	"github.com/phosae/llmp/router"
+	"github.com/phosae/llmp/translate"
+	"github.com/phosae/llmp/usage"
+	"github.com/phosae/llmp/vkeys"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 	"gopkg.in/yaml.v3"
 )
 
-type ModelConfig struct {
-	ModelName     string        `yaml:"model_name"`
-	LitellmParams LitellmParams `yaml:"litellm_params"`
-}
+// anthropicVersion is the API version sent to Anthropic-backed deployments.
+const anthropicVersion = "2023-06-01"
 
-type LitellmParams struct {
-	Model   string `yaml:"model"`
-	APIBase string `yaml:"api_base"`
-	APIKey  string `yaml:"api_key"`
+type Config struct {
+	ModelList []router.ModelConfig `yaml:"model_list"`
+	MasterKey string               `yaml:"master_key,omitempty"`
+	// AuthToken is the pre-virtual-keys name for MasterKey, kept so a
+	// config.yaml written before virtual keys existed still gates the proxy
+	// instead of silently opening it up. New configs should use master_key.
+	AuthToken   string      `yaml:"auth_token,omitempty"`
+	VirtualKeys []vkeys.Key `yaml:"virtual_keys,omitempty"`
+	KeyStore    struct {
+		Backend string `yaml:"backend"` // "memory" (default) or "file"
+		Path    string `yaml:"path"`
+	} `yaml:"key_store,omitempty"`
+	Cache cache.Config `yaml:"cache,omitempty"`
 }
 
-type Config struct {
-	ModelList []ModelConfig `yaml:"model_list"`
-	AuthToken string        `yaml:"auth_token,omitempty"`
+var (
+	modelRouter *router.Router
+	masterKey   string
+	keyStore    vkeys.Store
+	limiter     *vkeys.Limiter
+	respCache   *cache.Cache
+)
+
+// accessLogger writes structured JSON access log lines with no timestamp
+// prefix of its own, since each entry carries its own timing fields.
+var accessLogger = log.New(os.Stdout, "", 0)
+
+// accessLogEntry is one structured access log line, emitted per proxied
+// request so operators can feed it to a log pipeline.
+type accessLogEntry struct {
+	Model        string `json:"model"`
+	Deployment   string `json:"deployment,omitempty"`
+	VirtualKeyID string `json:"virtual_key_id,omitempty"`
+	TokensIn     int    `json:"tokens_in"`
+	TokensOut    int    `json:"tokens_out"`
+	TTFBMs       int64  `json:"ttfb_ms"`
+	TotalMs      int64  `json:"total_ms"`
+	Status       int    `json:"status"`
 }
 
-var modelConfigs map[string]ModelConfig
-var authToken string
+func logAccess(e accessLogEntry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Error encoding access log entry: %v", err)
+		return
+	}
+	accessLogger.Println(string(b))
+}
 
 func loadConfig(configPath string) error {
 	data, err := os.ReadFile(configPath)
@@ -45,53 +89,304 @@ func loadConfig(configPath string) error {
 		return err
 	}
 
-	modelConfigs = make(map[string]ModelConfig)
-	for _, modelConfig := range config.ModelList {
-		modelConfigs[modelConfig.ModelName] = modelConfig
+	modelRouter = router.New(config.ModelList)
+
+	masterKey = config.MasterKey
+	if masterKey == "" {
+		masterKey = config.AuthToken
+	}
+	// If no master key in config, check LITELLM_MASTER_KEY env var
+	if masterKey == "" {
+		masterKey = os.Getenv("LITELLM_MASTER_KEY")
 	}
 
-	authToken = config.AuthToken
+	if config.KeyStore.Backend == "file" && config.KeyStore.Path != "" {
+		fileStore, err := vkeys.NewFileStore(config.KeyStore.Path)
+		if err != nil {
+			return err
+		}
+		keyStore = fileStore
+	} else {
+		keyStore = vkeys.NewMemoryStore()
+	}
 
-	// If no auth token in config, check LITELLM_MASTER_KEY env var
-	if authToken == "" {
-		authToken = os.Getenv("LITELLM_MASTER_KEY")
+	for i := range config.VirtualKeys {
+		k := config.VirtualKeys[i]
+		if err := keyStore.Put(&k); err != nil {
+			return err
+		}
+	}
+
+	// Pre-virtual-keys configs gated every proxy call behind a single
+	// auth_token/LITELLM_MASTER_KEY. Preserve that behavior by synthesizing
+	// a virtual key from it when no virtual_keys block is configured,
+	// instead of silently opening the proxy up to every caller.
+	if len(config.VirtualKeys) == 0 && masterKey != "" {
+		if err := keyStore.Put(&vkeys.Key{Key: masterKey}); err != nil {
+			return err
+		}
 	}
 
+	if len(keyStore.List()) == 0 {
+		log.Printf("WARNING: no virtual_keys configured and no master_key/LITELLM_MASTER_KEY set - every /v1/... request will be served with no authentication")
+	}
+
+	limiter = vkeys.NewLimiter()
+
+	respCache = buildCache(config.Cache)
+
 	return nil
 }
 
+// buildCache wires up the response cache from its config block, or returns
+// nil if caching isn't configured. "redis" is accepted as a backend value
+// but not yet implemented; it falls back to an in-memory store.
+func buildCache(cfg cache.Config) *cache.Cache {
+	if cfg.Mode == "" {
+		return nil
+	}
+
+	ttl := time.Duration(cfg.TTLSeconds) * time.Second
+
+	var store cache.Store
+	switch cfg.Backend {
+	case "", "memory":
+		store = cache.NewMemoryStore(ttl)
+	case "file":
+		if cfg.Path == "" {
+			log.Printf("cache backend is \"file\" but no path is configured, falling back to memory")
+			store = cache.NewMemoryStore(ttl)
+			break
+		}
+		fileStore, err := cache.NewFileStore(cfg.Path, ttl)
+		if err != nil {
+			log.Printf("Error opening cache file store, falling back to memory: %v", err)
+			store = cache.NewMemoryStore(ttl)
+		} else {
+			store = fileStore
+		}
+	default:
+		log.Printf("WARNING: cache backend %q is not implemented, falling back to an in-memory, per-process cache", cfg.Backend)
+		store = cache.NewMemoryStore(ttl)
+	}
+
+	var embedder cache.EmbeddingProvider
+	if cfg.Mode == "semantic" && cfg.EmbeddingModel != "" {
+		embedder = &routerEmbedder{alias: cfg.EmbeddingModel}
+	}
+
+	return cache.New(cfg, store, embedder)
+}
+
+// routerEmbedder implements cache.EmbeddingProvider by calling the
+// embedding deployment named in cache.embedding_model through the same
+// router used for chat completions.
+type routerEmbedder struct {
+	alias string
+}
+
+func (e *routerEmbedder) Embed(text string) ([]float32, error) {
+	dep, ok := modelRouter.Pick(e.alias, nil)
+	if !ok {
+		return nil, fmt.Errorf("no available deployment for embedding model %q", e.alias)
+	}
+
+	resolvedModel := strings.TrimPrefix(strings.TrimPrefix(dep.Params.Model, "anthropic/"), "openai/")
+	body, err := sjson.SetBytes([]byte("{}"), "model", resolvedModel)
+	if err != nil {
+		return nil, err
+	}
+	body, err = sjson.SetBytes(body, "input", text)
+	if err != nil {
+		return nil, err
+	}
+
+	dep.Acquire()
+	defer dep.Release()
+
+	resp, err := sendUpstream(context.Background(), dep, "/v1/embeddings", body, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	values := gjson.GetBytes(respBody, "data.0.embedding").Array()
+	embedding := make([]float32, len(values))
+	for i, v := range values {
+		embedding[i] = float32(v.Float())
+	}
+	return embedding, nil
+}
+
 func isAnthropicModel(modelName string) bool {
 	return strings.HasPrefix(modelName, "anthropic/")
 }
 
+// requestFormat is "anthropic" or "openai", describing which API shape a
+// request or response body is in.
+type requestFormat string
+
+const (
+	formatAnthropic requestFormat = "anthropic"
+	formatOpenAI    requestFormat = "openai"
+)
+
+// clientFormat infers the format the caller is speaking from the request
+// path it hit.
+func clientFormat(path string) requestFormat {
+	if path == "/v1/messages" {
+		return formatAnthropic
+	}
+	return formatOpenAI
+}
+
+// backendFormat infers the format the resolved deployment speaks.
+func backendFormat(model string) requestFormat {
+	if isAnthropicModel(model) {
+		return formatAnthropic
+	}
+	return formatOpenAI
+}
+
+// virtualKeyContextKey is the context.Context key the resolved virtual key
+// is stashed under by authMiddleware.
+type virtualKeyContextKey struct{}
+
+func extractToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if apiKey := r.Header.Get("x-api-key"); apiKey != "" {
+		return apiKey
+	}
+	// Browsers can't set custom headers on a WebSocket handshake, so the ws
+	// endpoints accept the token as a "bearer, <token>" subprotocol pair
+	// instead.
+	for _, proto := range r.Header.Values("Sec-WebSocket-Protocol") {
+		protos := strings.Split(proto, ",")
+		for i, p := range protos {
+			if strings.EqualFold(strings.TrimSpace(p), "bearer") && i+1 < len(protos) {
+				return strings.TrimSpace(protos[i+1])
+			}
+		}
+	}
+	return ""
+}
+
+func virtualKeyFromContext(r *http.Request) *vkeys.Key {
+	k, _ := r.Context().Value(virtualKeyContextKey{}).(*vkeys.Key)
+	return k
+}
+
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if authToken == "" {
+		if len(keyStore.List()) == 0 {
 			next(w, r)
 			return
 		}
 
-		authHeader := r.Header.Get("Authorization")
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if authHeader == "" {
-			authHeader = r.Header.Get("x-api-key")
-			token = authHeader
-		}
-		if authHeader == "" {
+		token := extractToken(r)
+		if token == "" {
 			http.Error(w, "Authorization or x-api-key header required", http.StatusUnauthorized)
 			return
 		}
 
-		if token != authToken {
+		key, ok := keyStore.Get(token)
+		if !ok {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
+		if key.Expired() {
+			http.Error(w, "Virtual key has expired", http.StatusUnauthorized)
+			return
+		}
+		if key.MaxBudgetUSD > 0 && keyStore.Spend(key.Key) >= key.MaxBudgetUSD {
+			http.Error(w, "Virtual key has exceeded its budget", http.StatusPaymentRequired)
+			return
+		}
+		if !limiter.AllowRequest(key) {
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		if !limiter.AllowTokens(key) {
+			http.Error(w, "Token-per-minute budget exhausted", http.StatusTooManyRequests)
+			return
+		}
 
+		ctx := context.WithValue(r.Context(), virtualKeyContextKey{}, key)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// adminAuthMiddleware gates the /admin endpoints behind the separate
+// master key, independent of any virtual key.
+func adminAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if masterKey == "" {
+			http.Error(w, "Admin API disabled: no master key configured", http.StatusForbidden)
+			return
+		}
+		if extractToken(r) != masterKey {
+			http.Error(w, "Invalid master key", http.StatusUnauthorized)
+			return
+		}
 		next(w, r)
 	}
 }
 
+// adminKeysHandler implements CRUD for virtual keys: GET lists them, POST
+// creates or updates one, and DELETE removes one by its ?key= value.
+func adminKeysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(keyStore.List()); err != nil {
+			log.Printf("Error encoding key list: %v", err)
+		}
+
+	case http.MethodPost:
+		var k vkeys.Key
+		if err := json.NewDecoder(r.Body).Decode(&k); err != nil {
+			http.Error(w, "Invalid key payload", http.StatusBadRequest)
+			return
+		}
+		if k.Key == "" {
+			http.Error(w, "key field is required", http.StatusBadRequest)
+			return
+		}
+		if err := keyStore.Put(&k); err != nil {
+			http.Error(w, "Error saving key: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key query parameter is required", http.StatusBadRequest)
+			return
+		}
+		if err := keyStore.Delete(key); err != nil {
+			http.Error(w, "Error deleting key: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func proxyToUpstream(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	metrics.Inflight.Inc()
+	defer metrics.Inflight.Dec()
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "Error reading request body", http.StatusBadRequest)
@@ -104,69 +399,72 @@ func proxyToUpstream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	config, exists := modelConfigs[modelName]
-	if !exists {
+	if !modelRouter.Exists(modelName) {
 		http.Error(w, "Model not found", http.StatusBadRequest)
 		return
 	}
 
-	if !isAnthropicModel(config.LitellmParams.Model) {
-		http.Error(w, "OpenAI models should use /chat/completions endpoint", http.StatusBadRequest)
-		return
-	}
-
-	modifiedBody, err := sjson.SetBytes(body, "model", func(m string) string {
-		if isAnthropicModel(m) {
-			return strings.TrimPrefix(m, "anthropic/")
-		} else {
-			return strings.TrimPrefix(m, "openai/")
-		}
-	}(config.LitellmParams.Model))
-	if err != nil {
-		http.Error(w, "Error modifying request", http.StatusInternalServerError)
+	vk := virtualKeyFromContext(r)
+	if vk != nil && !vk.AllowsModel(modelName) {
+		http.Error(w, "Model not allowed for this key", http.StatusForbidden)
 		return
 	}
 
-	upstreamURL := strings.TrimSuffix(config.LitellmParams.APIBase, "/") + r.URL.Path
-
-	log.Printf("Upstream URL: %s", upstreamURL)
-	log.Printf("Request body: %s", string(modifiedBody))
-
+	clientFmt := clientFormat(r.URL.Path)
 	isStream := gjson.GetBytes(body, "stream").Bool()
 
-	var client *http.Client
-	if isStream {
-		client = &http.Client{}
-	} else {
-		client = &http.Client{
-			Timeout: 30 * time.Second,
+	cacheResult := "bypass"
+	if respCache != nil {
+		if respCache.Bypass(body) {
+			cacheResult = "bypass"
+		} else if entry, hit := respCache.Lookup(body); hit {
+			metrics.CacheResultTotal.WithLabelValues(modelName, "hit").Inc()
+			w.Header().Set("x-llmp-cache", "hit")
+			serveCachedResponse(w, entry, clientFmt, isStream)
+			logAccess(accessLogEntry{
+				Model:   modelName,
+				TTFBMs:  time.Since(start).Milliseconds(),
+				TotalMs: time.Since(start).Milliseconds(),
+				Status:  http.StatusOK,
+			})
+			return
+		} else {
+			cacheResult = "miss"
 		}
 	}
+	w.Header().Set("x-llmp-cache", cacheResult)
+	metrics.CacheResultTotal.WithLabelValues(modelName, cacheResult).Inc()
 
-	req, err := http.NewRequest("POST", upstreamURL, bytes.NewBuffer(modifiedBody))
+	resp, dep, err := dispatch(r.Context(), modelName, r.URL.Path, body, clientFmt, isStream)
+	ttfb := time.Since(start)
 	if err != nil {
-		http.Error(w, "Error creating request", http.StatusInternalServerError)
+		metrics.UpstreamErrorsTotal.WithLabelValues(modelName).Inc()
+		http.Error(w, "All deployments failed: "+err.Error(), http.StatusBadGateway)
+		logAccess(accessLogEntry{
+			Model:        modelName,
+			VirtualKeyID: virtualKeyID(vk),
+			TTFBMs:       ttfb.Milliseconds(),
+			TotalMs:      time.Since(start).Milliseconds(),
+			Status:       http.StatusBadGateway,
+		})
 		return
 	}
+	defer dep.Release()
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "llmp-proxy/1.0")
-
-	if config.LitellmParams.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+config.LitellmParams.APIKey)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Error forwarding request", http.StatusBadGateway)
-		return
-	}
+	backendFmt := backendFormat(dep.Params.Model)
+	translating := clientFmt != backendFmt
+	anthropicBackend := backendFmt == formatAnthropic
 
 	log.Printf("Upstream response status: %d, headers: %v", resp.StatusCode, resp.Header)
 
+	// api_base is an internal infra detail, not something to disclose to
+	// every caller - only alias and resolved model go in the header.
+	w.Header().Set("x-llmp-deployment", dep.Alias+"|"+dep.Params.Model)
+
 	for key, values := range resp.Header {
-		// Skip Content-Length for streaming responses to avoid conflict with Transfer-Encoding: chunked
-		if isStream && strings.ToLower(key) == "content-length" {
+		// Skip Content-Length when streaming or translating, since either can
+		// change the body size relative to what the upstream declared.
+		if (isStream || translating) && strings.ToLower(key) == "content-length" {
 			continue
 		}
 		// Skip Transfer-Encoding as Go will set it automatically for chunked responses
@@ -183,6 +481,8 @@ func proxyToUpstream(w http.ResponseWriter, r *http.Request) {
 	// Write the status code first
 	w.WriteHeader(resp.StatusCode)
 
+	var tokenUsage usage.Usage
+
 	if isStream {
 		flusher, ok := w.(http.Flusher)
 		if !ok {
@@ -191,33 +491,443 @@ func proxyToUpstream(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Use Scanner for line-based LLM streaming (SSE format)
-		scanner := bufio.NewScanner(resp.Body)
-		scanner.Buffer(make([]byte, 64<<10), 10<<20) // 10MB max buffer
-		scanner.Split(bufio.ScanLines)
+		sink := newSSESink(w, flusher)
+		extractor := usage.NewStreamExtractor(anthropicBackend)
+		switch {
+		case translating && backendFmt == formatAnthropic:
+			streamAnthropicToOpenAI(resp.Body, sink, extractor)
+		case translating:
+			streamOpenAIToAnthropic(resp.Body, sink, extractor)
+		default:
+			streamPassthrough(resp.Body, sink, extractor)
+		}
+		tokenUsage = extractor.Usage()
 
-		for scanner.Scan() {
-			line := scanner.Text()
-			log.Printf("Streaming line: %s", line) // Debug log
+		if respCache != nil && cacheResult == "miss" {
+			storeStreamedResponse(body, extractor, tokenUsage, anthropicBackend, translating)
+		}
 
-			// Write the complete line with proper SSE format
-			if _, writeErr := w.Write([]byte(line + "\n")); writeErr != nil {
-				log.Printf("Error writing streaming line: %v", writeErr)
+		log.Printf("Streaming completed")
+	} else {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Printf("Error reading upstream response: %v", err)
+			return
+		}
+		tokenUsage = usage.ExtractNonStreaming(respBody, anthropicBackend)
+
+		out := respBody
+		if translating {
+			if anthropicBackend {
+				out, err = translate.FromAnthropicResponse(respBody)
+			} else {
+				out, err = translate.FromOpenAIResponse(respBody)
+			}
+			if err != nil {
+				log.Printf("Error translating response: %v", err)
 				return
 			}
-			flusher.Flush() // Flush after each complete line
 		}
 
-		// Check for scanner errors
-		if err := scanner.Err(); err != nil {
-			log.Printf("Scanner error in streaming response: %v", err)
+		if respCache != nil && cacheResult == "miss" {
+			respCache.Store(body, out)
 		}
 
-		log.Printf("Streaming completed")
+		if _, err := w.Write(out); err != nil {
+			log.Printf("Error writing response: %v", err)
+		}
+	}
+
+	recordUsage(vk, dep, tokenUsage)
+
+	metrics.RequestsTotal.WithLabelValues(modelName, dep.Params.Model, strconv.Itoa(resp.StatusCode)).Inc()
+	metrics.TokensTotal.WithLabelValues(modelName, "prompt").Add(float64(tokenUsage.PromptTokens))
+	metrics.TokensTotal.WithLabelValues(modelName, "completion").Add(float64(tokenUsage.CompletionTokens))
+	metrics.RequestDuration.WithLabelValues(modelName).Observe(time.Since(start).Seconds())
+
+	logAccess(accessLogEntry{
+		Model:        modelName,
+		Deployment:   dep.Params.Model,
+		VirtualKeyID: virtualKeyID(vk),
+		TokensIn:     tokenUsage.PromptTokens,
+		TokensOut:    tokenUsage.CompletionTokens,
+		TTFBMs:       ttfb.Milliseconds(),
+		TotalMs:      time.Since(start).Milliseconds(),
+		Status:       resp.StatusCode,
+	})
+}
+
+// virtualKeyID returns vk's identifier for logging, or "" if the request
+// wasn't authenticated with a virtual key.
+func virtualKeyID(vk *vkeys.Key) string {
+	if vk == nil {
+		return ""
+	}
+	return vk.Key
+}
+
+// recordUsage charges tokenUsage against vk's token-per-minute budget and
+// cumulative spend, using dep's per-1k token costs.
+func recordUsage(vk *vkeys.Key, dep *router.Deployment, tokenUsage usage.Usage) {
+	if vk == nil {
+		return
+	}
+
+	limiter.ChargeTokens(vk, tokenUsage.PromptTokens+tokenUsage.CompletionTokens)
+
+	cost := float64(tokenUsage.PromptTokens)/1000*dep.Params.InputCostPer1K +
+		float64(tokenUsage.CompletionTokens)/1000*dep.Params.OutputCostPer1K
+	if cost > 0 {
+		if _, err := keyStore.AddSpend(vk.Key, cost); err != nil {
+			log.Printf("Error recording spend for virtual key: %v", err)
+		}
+	}
+}
+
+// storeStreamedResponse reassembles the completion extractor accumulated
+// while relaying a streaming response into a non-streaming-shaped response
+// body, in the client's own format, and caches it against reqBody. A
+// streaming request otherwise never populates the cache, since the proxy
+// only ever sees one completed response to store for a non-streaming
+// request.
+func storeStreamedResponse(reqBody []byte, extractor *usage.StreamExtractor, tokenUsage usage.Usage, anthropicBackend, translating bool) {
+	comp, ok := extractor.Completion()
+	if !ok {
+		return
+	}
+
+	var native []byte
+	var err error
+	if anthropicBackend {
+		native, err = translate.FromAnthropicStreamCompletion(comp, tokenUsage)
+	} else {
+		native, err = translate.FromOpenAIStreamCompletion(comp, tokenUsage)
+	}
+	if err != nil {
+		log.Printf("Error building cacheable response from stream: %v", err)
+		return
+	}
+
+	out := native
+	if translating {
+		if anthropicBackend {
+			out, err = translate.FromAnthropicResponse(native)
+		} else {
+			out, err = translate.FromOpenAIResponse(native)
+		}
+		if err != nil {
+			log.Printf("Error translating cacheable response from stream: %v", err)
+			return
+		}
+	}
+
+	respCache.Store(reqBody, out)
+}
+
+// serveCachedResponse replays a cache hit to the client: verbatim for a
+// non-streaming request, or as a synthetic SSE stream of delta/content-block
+// events if the client asked for stream:true. The cache only ever stores a
+// completed response, so a replayed stream arrives as one burst of events
+// rather than incrementally, but the event shapes match what a real
+// streaming request would have produced.
+func serveCachedResponse(w http.ResponseWriter, entry *cache.Entry, clientFmt requestFormat, isStream bool) {
+	flusher, canStream := w.(http.Flusher)
+	if !isStream || !canStream {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(entry.Response); err != nil {
+			log.Printf("Error writing cached response: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	if clientFmt == formatAnthropic {
+		writeCachedAnthropicStream(w, flusher, entry.Response)
 	} else {
-		if _, err := io.Copy(w, resp.Body); err != nil {
-			log.Printf("Error copying response: %v", err)
+		writeCachedOpenAIStream(w, flusher, entry.Response)
+	}
+}
+
+func writeCachedOpenAIStream(w http.ResponseWriter, flusher http.Flusher, cached []byte) {
+	chunks, err := translate.ReplayOpenAIStream(cached)
+	if err != nil {
+		log.Printf("Error replaying cached response as a stream: %v", err)
+		return
+	}
+	for _, c := range chunks {
+		if _, err := w.Write([]byte("data: " + c + "\n\n")); err != nil {
+			log.Printf("Error writing cached stream chunk: %v", err)
+			return
 		}
+		flusher.Flush()
+	}
+}
+
+func writeCachedAnthropicStream(w http.ResponseWriter, flusher http.Flusher, cached []byte) {
+	events, err := translate.ReplayAnthropicStream(cached)
+	if err != nil {
+		log.Printf("Error replaying cached response as a stream: %v", err)
+		return
+	}
+	for _, e := range events {
+		if _, err := w.Write([]byte("event: " + e.Event + "\ndata: " + e.Data + "\n\n")); err != nil {
+			log.Printf("Error writing cached stream chunk: %v", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// dispatch resolves modelName to a live deployment and sends the request,
+// retrying within the alias's pool and then across its configured fallback
+// aliases on a retryable failure. Deployments are only swapped before any
+// response has been returned to the caller, so an in-progress stream is
+// never retried mid-flight. The caller must Release the returned
+// Deployment once it is done with the response.
+func dispatch(ctx context.Context, modelName, path string, body []byte, clientFmt requestFormat, isStream bool) (*http.Response, *router.Deployment, error) {
+	aliasQueue := []string{modelName}
+	visited := map[string]bool{modelName: true}
+	var lastErr error
+
+	for qi := 0; qi < len(aliasQueue); qi++ {
+		alias := aliasQueue[qi]
+		excluded := map[*router.Deployment]bool{}
+
+		for attempt := 0; attempt < modelRouter.Retries(alias)+1; attempt++ {
+			dep, ok := modelRouter.Pick(alias, excluded)
+			if !ok {
+				break
+			}
+			excluded[dep] = true
+
+			backendFmt := backendFormat(dep.Params.Model)
+			upstreamBody, upstreamPath, err := buildUpstreamBody(body, path, dep.Params.Model, clientFmt, backendFmt)
+			if err != nil {
+				return nil, nil, err
+			}
+			if isStream && backendFmt == formatOpenAI {
+				if withUsage, err := usage.InjectIncludeUsage(upstreamBody); err == nil {
+					upstreamBody = withUsage
+				}
+			}
+
+			dep.Acquire()
+			resp, err := sendUpstream(ctx, dep, upstreamPath, upstreamBody, isStream)
+			if err != nil {
+				dep.Release()
+				modelRouter.RecordFailure(alias, dep)
+				lastErr = err
+				if modelRouter.ShouldRetry(alias, 0, true) {
+					continue
+				}
+				break
+			}
+
+			if modelRouter.ShouldRetry(alias, resp.StatusCode, false) {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				dep.Release()
+				modelRouter.RecordFailure(alias, dep)
+				lastErr = fmt.Errorf("upstream returned status %d", resp.StatusCode)
+				continue
+			}
+
+			modelRouter.RecordSuccess(dep)
+			return resp, dep, nil
+		}
+
+		for _, fb := range modelRouter.Fallbacks(alias) {
+			if !visited[fb] {
+				visited[fb] = true
+				aliasQueue = append(aliasQueue, fb)
+			}
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no available deployment for model %q", modelName)
+	}
+	return nil, nil, lastErr
+}
+
+// buildUpstreamBody sets the resolved backend model name on body and, if
+// the caller's format differs from the deployment's, translates the
+// request and returns the path that format expects upstream.
+func buildUpstreamBody(body []byte, path, model string, clientFmt, backendFmt requestFormat) ([]byte, string, error) {
+	resolvedModel := strings.TrimPrefix(strings.TrimPrefix(model, "anthropic/"), "openai/")
+	modifiedBody, err := sjson.SetBytes(body, "model", resolvedModel)
+	if err != nil {
+		return nil, "", fmt.Errorf("error modifying request: %w", err)
+	}
+
+	if clientFmt == backendFmt {
+		return modifiedBody, path, nil
+	}
+
+	if backendFmt == formatAnthropic {
+		modifiedBody, err = translate.ToAnthropic(modifiedBody)
+		path = "/v1/messages"
+	} else {
+		modifiedBody, err = translate.ToOpenAI(modifiedBody)
+		path = "/v1/chat/completions"
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error translating request: %w", err)
+	}
+
+	return modifiedBody, path, nil
+}
+
+// sendUpstream dials dep and returns its raw response. ctx governs the
+// request's lifetime, so cancelling it (e.g. because the client went away)
+// aborts the upstream call.
+func sendUpstream(ctx context.Context, dep *router.Deployment, path string, body []byte, isStream bool) (*http.Response, error) {
+	upstreamURL := strings.TrimSuffix(dep.Params.APIBase, "/") + path
+
+	var client *http.Client
+	if isStream {
+		client = &http.Client{}
+	} else {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", upstreamURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "llmp-proxy/1.0")
+
+	if backendFormat(dep.Params.Model) == formatAnthropic {
+		req.Header.Set("anthropic-version", anthropicVersion)
+		if dep.Params.APIKey != "" {
+			req.Header.Set("x-api-key", dep.Params.APIKey)
+		}
+	} else if dep.Params.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+dep.Params.APIKey)
+	}
+
+	log.Printf("Upstream URL: %s (deployment %s)", upstreamURL, dep.Params.Model)
+	log.Printf("Request body: %s", string(body))
+
+	return client.Do(req)
+}
+
+// streamAnthropicToOpenAI reads an Anthropic /v1/messages SSE stream from
+// body and writes it to sink as an OpenAI chat.completion.chunk SSE stream,
+// folding token usage from each upstream data line into extractor.
+func streamAnthropicToOpenAI(body io.Reader, sink StreamSink, extractor *usage.StreamExtractor) {
+	translator := translate.NewAnthropicToOpenAIStream()
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), 10<<20)
+
+	var event string
+	var data []byte
+	emit := func() {
+		if event == "" && len(data) == 0 {
+			return
+		}
+		extractor.Observe(data)
+		outs, err := translator.Translate(event, data)
+		if err != nil {
+			log.Printf("Error translating anthropic event %q: %v", event, err)
+		}
+		for _, o := range outs {
+			if writeErr := sink.WriteEvent([]byte("data: " + o + "\n\n")); writeErr != nil {
+				log.Printf("Error writing translated stream chunk: %v", writeErr)
+				return
+			}
+			sink.Flush()
+		}
+		event, data = "", nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = []byte(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		case line == "":
+			emit()
+		}
+	}
+	emit()
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Scanner error translating anthropic stream: %v", err)
+	}
+}
+
+// streamOpenAIToAnthropic reads an OpenAI chat.completion.chunk SSE stream
+// from body and writes it to sink as an Anthropic /v1/messages SSE stream,
+// folding token usage from each upstream data line into extractor.
+func streamOpenAIToAnthropic(body io.Reader, sink StreamSink, extractor *usage.StreamExtractor) {
+	translator := translate.NewOpenAIToAnthropicStream()
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), 10<<20)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := []byte(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		if len(data) == 0 {
+			continue
+		}
+		extractor.Observe(data)
+
+		events, err := translator.Translate(data)
+		if err != nil {
+			log.Printf("Error translating openai chunk: %v", err)
+			continue
+		}
+		for _, e := range events {
+			if writeErr := sink.WriteEvent([]byte("event: " + e.Event + "\ndata: " + e.Data + "\n\n")); writeErr != nil {
+				log.Printf("Error writing translated stream event: %v", writeErr)
+				return
+			}
+			sink.Flush()
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Scanner error translating openai stream: %v", err)
+	}
+}
+
+// streamPassthrough relays an SSE stream from body to sink unchanged,
+// folding token usage from each data line into extractor. Used when the
+// client and backend already speak the same format, so no translation is
+// needed.
+func streamPassthrough(body io.Reader, sink StreamSink, extractor *usage.StreamExtractor) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), 10<<20) // 10MB max buffer
+	scanner.Split(bufio.ScanLines)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		log.Printf("Streaming line: %s", line) // Debug log
+
+		if strings.HasPrefix(line, "data:") {
+			extractor.Observe([]byte(strings.TrimPrefix(line, "data:")))
+		}
+
+		// Write the complete line with proper SSE format
+		if writeErr := sink.WriteEvent([]byte(line + "\n")); writeErr != nil {
+			log.Printf("Error writing streaming line: %v", writeErr)
+			return
+		}
+		sink.Flush() // Flush after each complete line
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Scanner error in streaming response: %v", err)
 	}
 }
 
@@ -231,11 +941,15 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	log.Printf("Loaded %d models from config", len(modelConfigs))
+	log.Printf("Loaded %d models from config", modelRouter.Count())
 
 	http.HandleFunc("/v1/chat/completions", authMiddleware(proxyToUpstream))
 	http.HandleFunc("/chat/completions", authMiddleware(proxyToUpstream))
 	http.HandleFunc("/v1/messages", authMiddleware(proxyToUpstream))
+	http.HandleFunc("/v1/chat/completions/ws", authMiddleware(wsChatCompletionsHandler))
+	http.HandleFunc("/v1/messages/ws", authMiddleware(wsMessagesHandler))
+	http.HandleFunc("/admin/keys", adminAuthMiddleware(adminKeysHandler))
+	http.Handle("/metrics", promhttp.Handler())
 
 	port := ":8400"
 	log.Printf("Starting proxy server on port %s", port)
@@ -0,0 +1,52 @@
+// Package metrics holds the Prometheus collectors the proxy reports at
+// /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// RequestsTotal counts proxied requests by model alias, the deployment
+	// that served them, and the final status code.
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "llmp_requests_total",
+		Help: "Total proxied requests, by model, deployment, and status.",
+	}, []string{"model", "deployment", "status"})
+
+	// TokensTotal counts tokens processed, split by direction.
+	TokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "llmp_tokens_total",
+		Help: "Total tokens processed, by model and direction (prompt or completion).",
+	}, []string{"model", "direction"})
+
+	// RequestDuration observes end-to-end proxied request latency.
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "llmp_request_duration_seconds",
+		Help:    "End-to-end latency of proxied requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"model"})
+
+	// UpstreamErrorsTotal counts requests for which no deployment produced a
+	// usable response: every attempt, fallbacks included, ended in a
+	// transport error or a retryable status. It is incremented once per
+	// such request, not once per failed attempt.
+	UpstreamErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "llmp_upstream_errors_total",
+		Help: "Total requests for which every upstream attempt failed, by model.",
+	}, []string{"model"})
+
+	// Inflight is the number of requests currently being proxied.
+	Inflight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "llmp_inflight",
+		Help: "Requests currently being proxied.",
+	})
+
+	// CacheResultTotal counts response-cache lookups by model and outcome
+	// (hit, miss, or bypass).
+	CacheResultTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "llmp_cache_result_total",
+		Help: "Total response-cache lookups, by model and result.",
+	}, []string{"model", "result"})
+)
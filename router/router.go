@@ -0,0 +1,260 @@
+// Package router resolves a model alias configured in config.yaml to a
+// live upstream deployment, applying retries, fallbacks, and a
+// load-balancing strategy across the alias's deployment pool.
+package router
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// failureThreshold is how many consecutive failures a deployment tolerates
+// before it is taken out of rotation for its pool's cooldown period.
+const failureThreshold = 3
+
+// LitellmParams describes one backend deployment behind a model alias.
+type LitellmParams struct {
+	Model           string  `yaml:"model"`
+	APIBase         string  `yaml:"api_base"`
+	APIKey          string  `yaml:"api_key"`
+	Weight          int     `yaml:"weight,omitempty"`
+	InputCostPer1K  float64 `yaml:"input_cost_per_1k,omitempty"`
+	OutputCostPer1K float64 `yaml:"output_cost_per_1k,omitempty"`
+}
+
+// Config is the router policy for one model alias.
+type Config struct {
+	Retries         int      `yaml:"retries"`
+	Fallbacks       []string `yaml:"fallbacks"`
+	Strategy        string   `yaml:"strategy"`
+	CooldownSeconds int      `yaml:"cooldown_seconds"`
+	RetryOn         []string `yaml:"retry_on"`
+}
+
+// ModelConfig is one model_list entry: an alias, its deployment pool, and
+// the router policy to apply across that pool.
+type ModelConfig struct {
+	ModelName     string          `yaml:"model_name"`
+	LitellmParams []LitellmParams `yaml:"litellm_params"`
+	Router        Config          `yaml:"router"`
+}
+
+// Deployment is one backend instance within a model alias's pool, with the
+// health bookkeeping the Router uses to take it out of rotation.
+type Deployment struct {
+	Alias  string
+	Params LitellmParams
+
+	inFlight      int64
+	failures      int64
+	cooldownUntil int64 // unix nano; 0 means not cooling down
+}
+
+// Acquire marks d as handling one more in-flight request.
+func (d *Deployment) Acquire() { atomic.AddInt64(&d.inFlight, 1) }
+
+// Release marks one in-flight request on d as finished.
+func (d *Deployment) Release() { atomic.AddInt64(&d.inFlight, -1) }
+
+// InFlight returns the number of requests currently in flight against d.
+func (d *Deployment) InFlight() int64 { return atomic.LoadInt64(&d.inFlight) }
+
+func (d *Deployment) inCooldown() bool {
+	until := atomic.LoadInt64(&d.cooldownUntil)
+	return until != 0 && time.Now().UnixNano() < until
+}
+
+func (d *Deployment) recordFailure(cooldown time.Duration) {
+	if n := atomic.AddInt64(&d.failures, 1); n >= failureThreshold && cooldown > 0 {
+		atomic.StoreInt64(&d.cooldownUntil, time.Now().Add(cooldown).UnixNano())
+	}
+}
+
+func (d *Deployment) recordSuccess() {
+	atomic.StoreInt64(&d.failures, 0)
+	atomic.StoreInt64(&d.cooldownUntil, 0)
+}
+
+// pool is the set of deployments behind one model alias, plus its policy.
+type pool struct {
+	strategy    string
+	retries     int
+	fallbacks   []string
+	cooldown    time.Duration
+	retryOn     map[string]bool
+	deployments []*Deployment
+	rrCounter   uint64
+}
+
+// Router resolves a model alias to a Deployment per its configured
+// strategy (round-robin, weighted, or least-busy), skipping deployments
+// that are mid-cooldown after repeated failures.
+type Router struct {
+	mu    sync.RWMutex
+	pools map[string]*pool
+}
+
+// New builds a Router from the model_list section of config.yaml.
+func New(configs []ModelConfig) *Router {
+	r := &Router{pools: make(map[string]*pool)}
+	for _, c := range configs {
+		p := &pool{
+			strategy:  c.Router.Strategy,
+			retries:   c.Router.Retries,
+			fallbacks: c.Router.Fallbacks,
+			cooldown:  time.Duration(c.Router.CooldownSeconds) * time.Second,
+			retryOn:   retryOnSet(c.Router.RetryOn),
+		}
+		for _, lp := range c.LitellmParams {
+			p.deployments = append(p.deployments, &Deployment{Alias: c.ModelName, Params: lp})
+		}
+		r.pools[c.ModelName] = p
+	}
+	return r
+}
+
+func retryOnSet(entries []string) map[string]bool {
+	set := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		set[strings.ToLower(strings.TrimSpace(e))] = true
+	}
+	return set
+}
+
+// Count returns the number of model aliases the Router knows about.
+func (r *Router) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.pools)
+}
+
+// Exists reports whether alias is a known model.
+func (r *Router) Exists(alias string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.pools[alias]
+	return ok
+}
+
+// Retries returns the configured retry count for alias.
+func (r *Router) Retries(alias string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.pools[alias]; ok {
+		return p.retries
+	}
+	return 0
+}
+
+// Fallbacks returns alias's configured fallback aliases, in order.
+func (r *Router) Fallbacks(alias string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.pools[alias]; ok {
+		return p.fallbacks
+	}
+	return nil
+}
+
+// ShouldRetry reports whether a failed attempt against alias warrants
+// another try, per its configured retry_on list. transportErr is true for
+// dial/timeout failures that never produced a status code.
+func (r *Router) ShouldRetry(alias string, statusCode int, transportErr bool) bool {
+	r.mu.RLock()
+	p, ok := r.pools[alias]
+	r.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	if transportErr {
+		return p.retryOn["timeout"]
+	}
+	return p.retryOn[strconv.Itoa(statusCode)]
+}
+
+// Pick selects the next Deployment for alias using its configured
+// strategy, skipping any deployment in excluded or mid-cooldown. ok is
+// false once the pool has nothing left to try.
+func (r *Router) Pick(alias string, excluded map[*Deployment]bool) (dep *Deployment, ok bool) {
+	r.mu.RLock()
+	p, exists := r.pools[alias]
+	r.mu.RUnlock()
+	if !exists || len(p.deployments) == 0 {
+		return nil, false
+	}
+
+	var candidates []*Deployment
+	for _, d := range p.deployments {
+		if excluded[d] || d.inCooldown() {
+			continue
+		}
+		candidates = append(candidates, d)
+	}
+	if len(candidates) == 0 {
+		return nil, false
+	}
+
+	switch p.strategy {
+	case "weighted":
+		return pickWeighted(candidates), true
+	case "least-busy":
+		return pickLeastBusy(candidates), true
+	default: // "round-robin" and unset
+		idx := atomic.AddUint64(&p.rrCounter, 1) - 1
+		return candidates[idx%uint64(len(candidates))], true
+	}
+}
+
+func pickWeighted(candidates []*Deployment) *Deployment {
+	total := 0
+	for _, d := range candidates {
+		total += weightOf(d)
+	}
+	n := rand.Intn(total)
+	for _, d := range candidates {
+		w := weightOf(d)
+		if n < w {
+			return d
+		}
+		n -= w
+	}
+	return candidates[len(candidates)-1]
+}
+
+func weightOf(d *Deployment) int {
+	if d.Params.Weight <= 0 {
+		return 1
+	}
+	return d.Params.Weight
+}
+
+func pickLeastBusy(candidates []*Deployment) *Deployment {
+	best := candidates[0]
+	for _, d := range candidates[1:] {
+		if d.InFlight() < best.InFlight() {
+			best = d
+		}
+	}
+	return best
+}
+
+// RecordFailure notes a failed attempt against d, applying alias's
+// configured cooldown once the failure threshold is reached.
+func (r *Router) RecordFailure(alias string, d *Deployment) {
+	r.mu.RLock()
+	p, ok := r.pools[alias]
+	r.mu.RUnlock()
+	if !ok {
+		return
+	}
+	d.recordFailure(p.cooldown)
+}
+
+// RecordSuccess clears d's failure count and any active cooldown.
+func (r *Router) RecordSuccess(d *Deployment) {
+	d.recordSuccess()
+}
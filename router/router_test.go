@@ -0,0 +1,199 @@
+package router
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPickRoundRobinCyclesDeployments(t *testing.T) {
+	r := New([]ModelConfig{{
+		ModelName: "gpt-4o",
+		LitellmParams: []LitellmParams{
+			{Model: "openai/gpt-4o-a"},
+			{Model: "openai/gpt-4o-b"},
+		},
+	}})
+
+	var seen []string
+	for i := 0; i < 4; i++ {
+		dep, ok := r.Pick("gpt-4o", nil)
+		if !ok {
+			t.Fatalf("Pick() returned ok=false on iteration %d", i)
+		}
+		seen = append(seen, dep.Params.Model)
+	}
+
+	want := []string{"openai/gpt-4o-a", "openai/gpt-4o-b", "openai/gpt-4o-a", "openai/gpt-4o-b"}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("pick %d = %s, want %s", i, seen[i], want[i])
+		}
+	}
+}
+
+func TestPickSkipsExcludedAndCooldownDeployments(t *testing.T) {
+	r := New([]ModelConfig{{
+		ModelName: "gpt-4o",
+		Router:    Config{CooldownSeconds: 60},
+		LitellmParams: []LitellmParams{
+			{Model: "openai/gpt-4o-a"},
+			{Model: "openai/gpt-4o-b"},
+		},
+	}})
+
+	first, ok := r.Pick("gpt-4o", nil)
+	if !ok {
+		t.Fatal("Pick() ok=false")
+	}
+
+	excluded := map[*Deployment]bool{first: true}
+	second, ok := r.Pick("gpt-4o", excluded)
+	if !ok {
+		t.Fatal("Pick() ok=false with first deployment excluded")
+	}
+	if second == first {
+		t.Fatal("Pick() returned an excluded deployment")
+	}
+
+	for i := 0; i < failureThreshold; i++ {
+		r.RecordFailure("gpt-4o", second)
+	}
+	if _, ok := r.Pick("gpt-4o", excluded); ok {
+		t.Error("Pick() returned a deployment that should be excluded and in cooldown")
+	}
+
+	r.RecordSuccess(second)
+	if got, ok := r.Pick("gpt-4o", excluded); !ok || got != second {
+		t.Error("Pick() should return the deployment again once RecordSuccess clears its cooldown")
+	}
+}
+
+func TestPickReturnsFalseWhenPoolExhausted(t *testing.T) {
+	r := New([]ModelConfig{{
+		ModelName:     "gpt-4o",
+		LitellmParams: []LitellmParams{{Model: "openai/gpt-4o-a"}},
+	}})
+
+	dep, ok := r.Pick("gpt-4o", nil)
+	if !ok {
+		t.Fatal("Pick() ok=false")
+	}
+
+	if _, ok := r.Pick("gpt-4o", map[*Deployment]bool{dep: true}); ok {
+		t.Error("Pick() should return ok=false once every deployment is excluded")
+	}
+	if _, ok := r.Pick("does-not-exist", nil); ok {
+		t.Error("Pick() should return ok=false for an unknown alias")
+	}
+}
+
+func TestPickWeightedFavorsHeavierDeployment(t *testing.T) {
+	r := New([]ModelConfig{{
+		ModelName: "gpt-4o",
+		Router:    Config{Strategy: "weighted"},
+		LitellmParams: []LitellmParams{
+			{Model: "openai/gpt-4o-heavy", Weight: 99},
+			{Model: "openai/gpt-4o-light", Weight: 1},
+		},
+	}})
+
+	counts := map[string]int{}
+	for i := 0; i < 200; i++ {
+		dep, ok := r.Pick("gpt-4o", nil)
+		if !ok {
+			t.Fatal("Pick() ok=false")
+		}
+		counts[dep.Params.Model]++
+	}
+
+	if counts["openai/gpt-4o-heavy"] <= counts["openai/gpt-4o-light"] {
+		t.Errorf("expected the weight-99 deployment to be picked far more often, got %v", counts)
+	}
+}
+
+func TestPickLeastBusyPrefersFewerInFlight(t *testing.T) {
+	r := New([]ModelConfig{{
+		ModelName: "gpt-4o",
+		Router:    Config{Strategy: "least-busy"},
+		LitellmParams: []LitellmParams{
+			{Model: "openai/gpt-4o-a"},
+			{Model: "openai/gpt-4o-b"},
+		},
+	}})
+
+	first, ok := r.Pick("gpt-4o", nil)
+	if !ok {
+		t.Fatal("Pick() ok=false")
+	}
+	first.Acquire()
+	first.Acquire()
+
+	got, ok := r.Pick("gpt-4o", nil)
+	if !ok {
+		t.Fatal("Pick() ok=false")
+	}
+	if got == first {
+		t.Error("least-busy strategy picked the deployment with more in-flight requests")
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	r := New([]ModelConfig{{
+		ModelName: "gpt-4o",
+		Router:    Config{RetryOn: []string{"timeout", "429", "503"}},
+	}})
+
+	cases := []struct {
+		name         string
+		statusCode   int
+		transportErr bool
+		want         bool
+	}{
+		{"configured status retries", 429, false, true},
+		{"unconfigured status does not retry", 500, false, false},
+		{"transport error retries when timeout configured", 0, true, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := r.ShouldRetry("gpt-4o", c.statusCode, c.transportErr); got != c.want {
+				t.Errorf("ShouldRetry(%d, %v) = %v, want %v", c.statusCode, c.transportErr, got, c.want)
+			}
+		})
+	}
+
+	if r.ShouldRetry("does-not-exist", 429, false) {
+		t.Error("ShouldRetry() should be false for an unknown alias")
+	}
+}
+
+func TestRecordFailureRequiresThresholdBeforeCooldown(t *testing.T) {
+	r := New([]ModelConfig{{
+		ModelName:     "gpt-4o",
+		Router:        Config{CooldownSeconds: 60},
+		LitellmParams: []LitellmParams{{Model: "openai/gpt-4o-a"}},
+	}})
+
+	dep, ok := r.Pick("gpt-4o", nil)
+	if !ok {
+		t.Fatal("Pick() ok=false")
+	}
+
+	for i := 0; i < failureThreshold-1; i++ {
+		r.RecordFailure("gpt-4o", dep)
+		if dep.inCooldown() {
+			t.Fatalf("deployment entered cooldown after only %d failures", i+1)
+		}
+	}
+
+	r.RecordFailure("gpt-4o", dep)
+	if !dep.inCooldown() {
+		t.Error("deployment should be in cooldown after reaching the failure threshold")
+	}
+
+	time.Sleep(time.Millisecond)
+	r.RecordSuccess(dep)
+	if dep.inCooldown() {
+		t.Error("RecordSuccess should clear an active cooldown")
+	}
+}
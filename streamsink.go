@@ -0,0 +1,34 @@
+package main
+
+import "net/http"
+
+// StreamSink is the destination a relayed stream event is written to,
+// abstracting over the wire transport (SSE today, WebSocket as of
+// phosae/llmp#chunk0-5) so the translation loops in streamAnthropicToOpenAI,
+// streamOpenAIToAnthropic, and streamPassthrough don't need to know which
+// one they're writing to.
+type StreamSink interface {
+	// WriteEvent writes one already-framed stream event. For SSE this is a
+	// raw line (or "event: ...\ndata: ...\n\n" block); implementations that
+	// frame differently (e.g. WebSocket) extract what they need from it.
+	WriteEvent(line []byte) error
+	// Flush makes any buffered event visible to the client immediately.
+	Flush()
+}
+
+// sseSink is the StreamSink backing today's Server-Sent Events responses.
+type sseSink struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSESink(w http.ResponseWriter, flusher http.Flusher) *sseSink {
+	return &sseSink{w: w, flusher: flusher}
+}
+
+func (s *sseSink) WriteEvent(line []byte) error {
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *sseSink) Flush() { s.flusher.Flush() }
@@ -0,0 +1,223 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/phosae/llmp/usage"
+)
+
+type anthropicResponse struct {
+	ID         string             `json:"id"`
+	Model      string             `json:"model"`
+	Role       string             `json:"role"`
+	Content    []anthropicContent `json:"content"`
+	StopReason string             `json:"stop_reason"`
+	Usage      anthropicUsage     `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type openAIResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   openAIUsage    `json:"usage"`
+}
+
+type openAIChoice struct {
+	Index        int           `json:"index"`
+	Message      openAIMessage `json:"message"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// stopReasonToFinishReason maps an Anthropic stop_reason to its OpenAI
+// finish_reason equivalent.
+func stopReasonToFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	default:
+		return "stop"
+	}
+}
+
+// finishReasonToStopReason is the inverse of stopReasonToFinishReason.
+func finishReasonToStopReason(reason string) string {
+	switch reason {
+	case "tool_calls":
+		return "tool_use"
+	case "length":
+		return "max_tokens"
+	default:
+		return "end_turn"
+	}
+}
+
+// FromAnthropicResponse converts a non-streaming Anthropic /v1/messages
+// response body into an OpenAI chat.completion response body.
+func FromAnthropicResponse(body []byte) ([]byte, error) {
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("translate: decode anthropic response: %w", err)
+	}
+
+	msg := openAIMessage{Role: "assistant"}
+	for _, c := range resp.Content {
+		switch c.Type {
+		case "text":
+			msg.Content += c.Text
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, openAIToolCall{
+				ID:   c.ID,
+				Type: "function",
+				Function: openAIFunctionCall{
+					Name:      c.Name,
+					Arguments: string(c.Input),
+				},
+			})
+		}
+	}
+
+	out := openAIResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []openAIChoice{{
+			Index:        0,
+			Message:      msg,
+			FinishReason: stopReasonToFinishReason(resp.StopReason),
+		}},
+		Usage: openAIUsage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}
+
+	return json.Marshal(out)
+}
+
+// FromOpenAIStreamCompletion builds a non-streaming chat.completion
+// response body out of c and u, accumulated off a streaming response by a
+// usage.StreamExtractor, so a streamed request's full completion can be
+// cached and replayed the same way as a non-streaming one's.
+func FromOpenAIStreamCompletion(c usage.Completion, u usage.Usage) ([]byte, error) {
+	msg := openAIMessage{Role: "assistant", Content: c.Content}
+	for _, tc := range c.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, openAIToolCall{
+			ID:       tc.ID,
+			Type:     "function",
+			Function: openAIFunctionCall{Name: tc.Name, Arguments: tc.Arguments},
+		})
+	}
+
+	out := openAIResponse{
+		ID:      c.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   c.Model,
+		Choices: []openAIChoice{{
+			Index:        0,
+			Message:      msg,
+			FinishReason: c.FinishReason,
+		}},
+		Usage: openAIUsage{
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			TotalTokens:      u.PromptTokens + u.CompletionTokens,
+		},
+	}
+
+	return json.Marshal(out)
+}
+
+// FromAnthropicStreamCompletion builds a non-streaming /v1/messages
+// response body out of c and u, accumulated off a streaming response by a
+// usage.StreamExtractor, so a streamed request's full completion can be
+// cached and replayed the same way as a non-streaming one's.
+func FromAnthropicStreamCompletion(c usage.Completion, u usage.Usage) ([]byte, error) {
+	var content []anthropicContent
+	if c.Content != "" {
+		content = append(content, anthropicContent{Type: "text", Text: c.Content})
+	}
+	for _, tc := range c.ToolCalls {
+		content = append(content, anthropicContent{
+			Type:  "tool_use",
+			ID:    tc.ID,
+			Name:  tc.Name,
+			Input: json.RawMessage(orEmptyObject(tc.Arguments)),
+		})
+	}
+
+	out := anthropicResponse{
+		ID:         c.ID,
+		Model:      c.Model,
+		Role:       "assistant",
+		Content:    content,
+		StopReason: c.FinishReason,
+		Usage: anthropicUsage{
+			InputTokens:  u.PromptTokens,
+			OutputTokens: u.CompletionTokens,
+		},
+	}
+
+	return json.Marshal(out)
+}
+
+// FromOpenAIResponse converts a non-streaming OpenAI chat.completion
+// response body into an Anthropic /v1/messages response body.
+func FromOpenAIResponse(body []byte) ([]byte, error) {
+	var resp openAIResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("translate: decode openai response: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("translate: openai response has no choices")
+	}
+	choice := resp.Choices[0]
+
+	var content []anthropicContent
+	if choice.Message.Content != "" {
+		content = append(content, anthropicContent{Type: "text", Text: choice.Message.Content})
+	}
+	for _, tc := range choice.Message.ToolCalls {
+		content = append(content, anthropicContent{
+			Type:  "tool_use",
+			ID:    tc.ID,
+			Name:  tc.Function.Name,
+			Input: json.RawMessage(orEmptyObject(tc.Function.Arguments)),
+		})
+	}
+
+	out := anthropicResponse{
+		ID:         resp.ID,
+		Model:      resp.Model,
+		Role:       "assistant",
+		Content:    content,
+		StopReason: finishReasonToStopReason(choice.FinishReason),
+		Usage: anthropicUsage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+		},
+	}
+
+	return json.Marshal(out)
+}
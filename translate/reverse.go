@@ -0,0 +1,108 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ToOpenAI converts an Anthropic /v1/messages request body into an OpenAI
+// /v1/chat/completions request body, the reverse of ToAnthropic.
+func ToOpenAI(body []byte) ([]byte, error) {
+	var req anthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("translate: decode anthropic request: %w", err)
+	}
+
+	out := openAIRequest{
+		Model:       req.Model,
+		Temperature: req.Temperature,
+		Stream:      req.Stream,
+		MaxTokens:   &req.MaxTokens,
+	}
+
+	if req.System != "" {
+		out.Messages = append(out.Messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		out.Messages = append(out.Messages, anthropicMessageToOpenAI(m)...)
+	}
+
+	for _, t := range req.Tools {
+		out.Tools = append(out.Tools, openAITool{
+			Type: "function",
+			Function: openAIToolFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.InputSchema,
+			},
+		})
+	}
+
+	if len(req.ToolChoice) > 0 {
+		out.ToolChoice = anthropicToolChoiceToOpenAI(req.ToolChoice)
+	}
+
+	return json.Marshal(out)
+}
+
+// anthropicMessageToOpenAI may expand a single Anthropic message into
+// several OpenAI messages, since tool_result blocks become their own
+// role:"tool" messages in OpenAI's format.
+func anthropicMessageToOpenAI(m anthropicMessage) []openAIMessage {
+	var text string
+	var toolCalls []openAIToolCall
+	var toolResults []openAIMessage
+
+	for _, c := range m.Content {
+		switch c.Type {
+		case "text":
+			text += c.Text
+		case "tool_use":
+			toolCalls = append(toolCalls, openAIToolCall{
+				ID:   c.ID,
+				Type: "function",
+				Function: openAIFunctionCall{
+					Name:      c.Name,
+					Arguments: string(c.Input),
+				},
+			})
+		case "tool_result":
+			toolResults = append(toolResults, openAIMessage{
+				Role:       "tool",
+				Content:    c.Content,
+				ToolCallID: c.ToolUseID,
+			})
+		}
+	}
+
+	if len(toolResults) > 0 {
+		return toolResults
+	}
+
+	return []openAIMessage{{Role: m.Role, Content: text, ToolCalls: toolCalls}}
+}
+
+func anthropicToolChoiceToOpenAI(raw json.RawMessage) json.RawMessage {
+	var typed struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		return json.RawMessage(`"auto"`)
+	}
+
+	switch typed.Type {
+	case "any":
+		return json.RawMessage(`"required"`)
+	case "none":
+		return json.RawMessage(`"none"`)
+	case "tool":
+		b, _ := json.Marshal(map[string]any{
+			"type":     "function",
+			"function": map[string]string{"name": typed.Name},
+		})
+		return b
+	default:
+		return json.RawMessage(`"auto"`)
+	}
+}
@@ -0,0 +1,400 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type openAIStreamChunk struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []openAIChunkChoice `json:"choices"`
+}
+
+type openAIChunkChoice struct {
+	Index        int         `json:"index"`
+	Delta        openAIDelta `json:"delta"`
+	FinishReason *string     `json:"finish_reason"`
+}
+
+type openAIDelta struct {
+	Role      string                `json:"role,omitempty"`
+	Content   string                `json:"content,omitempty"`
+	ToolCalls []openAIToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+type openAIToolCallDelta struct {
+	Index    int                  `json:"index"`
+	ID       string               `json:"id,omitempty"`
+	Type     string               `json:"type,omitempty"`
+	Function *openAIFunctionDelta `json:"function,omitempty"`
+}
+
+type openAIFunctionDelta struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// AnthropicToOpenAIStream translates a single Anthropic /v1/messages SSE
+// stream into OpenAI chat.completion.chunk SSE data lines. Create one per
+// request; feed it every SSE event in order via Translate.
+type AnthropicToOpenAIStream struct {
+	id        string
+	model     string
+	created   int64
+	toolIndex map[int]int // anthropic content-block index -> openai tool_calls[] index
+	nextTool  int
+}
+
+// NewAnthropicToOpenAIStream returns a ready-to-use translator.
+func NewAnthropicToOpenAIStream() *AnthropicToOpenAIStream {
+	return &AnthropicToOpenAIStream{toolIndex: make(map[int]int)}
+}
+
+// Translate consumes one Anthropic SSE event (its `event:` name and `data:`
+// payload) and returns the OpenAI SSE "data:" payloads it produces, if any.
+// The special payload "[DONE]" signals the end of the stream.
+func (s *AnthropicToOpenAIStream) Translate(event string, data []byte) ([]string, error) {
+	switch event {
+	case "message_start":
+		var m struct {
+			Message struct {
+				ID    string `json:"id"`
+				Model string `json:"model"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		s.id = m.Message.ID
+		s.model = m.Message.Model
+		s.created = time.Now().Unix()
+		return []string{s.chunk(openAIDelta{Role: "assistant"}, "")}, nil
+
+	case "content_block_start":
+		var b struct {
+			Index        int `json:"index"`
+			ContentBlock struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"content_block"`
+		}
+		if err := json.Unmarshal(data, &b); err != nil {
+			return nil, err
+		}
+		if b.ContentBlock.Type != "tool_use" {
+			return nil, nil
+		}
+		idx := s.nextTool
+		s.nextTool++
+		s.toolIndex[b.Index] = idx
+		return []string{s.chunk(openAIDelta{
+			ToolCalls: []openAIToolCallDelta{{
+				Index:    idx,
+				ID:       b.ContentBlock.ID,
+				Type:     "function",
+				Function: &openAIFunctionDelta{Name: b.ContentBlock.Name},
+			}},
+		}, "")}, nil
+
+	case "content_block_delta":
+		var d struct {
+			Index int `json:"index"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, err
+		}
+		switch d.Delta.Type {
+		case "text_delta":
+			return []string{s.chunk(openAIDelta{Content: d.Delta.Text}, "")}, nil
+		case "input_json_delta":
+			idx := s.toolIndex[d.Index]
+			return []string{s.chunk(openAIDelta{
+				ToolCalls: []openAIToolCallDelta{{
+					Index:    idx,
+					Function: &openAIFunctionDelta{Arguments: d.Delta.PartialJSON},
+				}},
+			}, "")}, nil
+		}
+		return nil, nil
+
+	case "message_delta":
+		var md struct {
+			Delta struct {
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal(data, &md); err != nil {
+			return nil, err
+		}
+		return []string{s.chunk(openAIDelta{}, stopReasonToFinishReason(md.Delta.StopReason))}, nil
+
+	case "message_stop":
+		return []string{"[DONE]"}, nil
+	}
+
+	return nil, nil
+}
+
+func (s *AnthropicToOpenAIStream) chunk(delta openAIDelta, finishReason string) string {
+	var fr *string
+	if finishReason != "" {
+		fr = &finishReason
+	}
+	c := openAIStreamChunk{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.created,
+		Model:   s.model,
+		Choices: []openAIChunkChoice{{Delta: delta, FinishReason: fr}},
+	}
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// ReplayOpenAIStream converts a completed chat.completion response body
+// into the chat.completion.chunk SSE "data:" payloads a streaming client
+// would have received for it, ending with "[DONE]". It's used to replay a
+// cached non-streaming completion to a client that asked for stream:true.
+func ReplayOpenAIStream(body []byte) ([]string, error) {
+	var resp openAIResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("translate: decode openai response: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("translate: openai response has no choices")
+	}
+	choice := resp.Choices[0]
+
+	s := &AnthropicToOpenAIStream{id: resp.ID, model: resp.Model, created: resp.Created}
+	if s.created == 0 {
+		s.created = time.Now().Unix()
+	}
+
+	chunks := []string{s.chunk(openAIDelta{Role: "assistant"}, "")}
+	if choice.Message.Content != "" {
+		chunks = append(chunks, s.chunk(openAIDelta{Content: choice.Message.Content}, ""))
+	}
+	for i, tc := range choice.Message.ToolCalls {
+		chunks = append(chunks, s.chunk(openAIDelta{ToolCalls: []openAIToolCallDelta{{
+			Index:    i,
+			ID:       tc.ID,
+			Type:     "function",
+			Function: &openAIFunctionDelta{Name: tc.Function.Name, Arguments: tc.Function.Arguments},
+		}}}, ""))
+	}
+	chunks = append(chunks, s.chunk(openAIDelta{}, choice.FinishReason), "[DONE]")
+
+	return chunks, nil
+}
+
+// ReplayAnthropicStream converts a completed Anthropic message response
+// body into the SSE events a streaming client would have received for it,
+// ending with message_stop. It's used to replay a cached non-streaming
+// completion to a client that asked for stream:true.
+func ReplayAnthropicStream(body []byte) ([]AnthropicSSEEvent, error) {
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("translate: decode anthropic response: %w", err)
+	}
+
+	start, _ := json.Marshal(map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id": resp.ID, "type": "message", "role": "assistant", "model": resp.Model,
+			"content": []any{}, "stop_reason": nil,
+			"usage": map[string]int{"input_tokens": resp.Usage.InputTokens, "output_tokens": 0},
+		},
+	})
+	events := []AnthropicSSEEvent{{Event: "message_start", Data: string(start)}}
+
+	for idx, c := range resp.Content {
+		switch c.Type {
+		case "text":
+			b, _ := json.Marshal(map[string]any{
+				"type": "content_block_start", "index": idx,
+				"content_block": map[string]string{"type": "text", "text": ""},
+			})
+			events = append(events, AnthropicSSEEvent{Event: "content_block_start", Data: string(b)})
+
+			d, _ := json.Marshal(map[string]any{
+				"type": "content_block_delta", "index": idx,
+				"delta": map[string]string{"type": "text_delta", "text": c.Text},
+			})
+			events = append(events, AnthropicSSEEvent{Event: "content_block_delta", Data: string(d)})
+
+		case "tool_use":
+			b, _ := json.Marshal(map[string]any{
+				"type": "content_block_start", "index": idx,
+				"content_block": map[string]any{"type": "tool_use", "id": c.ID, "name": c.Name, "input": map[string]any{}},
+			})
+			events = append(events, AnthropicSSEEvent{Event: "content_block_start", Data: string(b)})
+
+			d, _ := json.Marshal(map[string]any{
+				"type": "content_block_delta", "index": idx,
+				"delta": map[string]string{"type": "input_json_delta", "partial_json": orEmptyObject(string(c.Input))},
+			})
+			events = append(events, AnthropicSSEEvent{Event: "content_block_delta", Data: string(d)})
+
+		default:
+			continue
+		}
+
+		stop, _ := json.Marshal(map[string]any{"type": "content_block_stop", "index": idx})
+		events = append(events, AnthropicSSEEvent{Event: "content_block_stop", Data: string(stop)})
+	}
+
+	delta, _ := json.Marshal(map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]string{"stop_reason": resp.StopReason},
+		"usage": map[string]int{"output_tokens": resp.Usage.OutputTokens},
+	})
+	events = append(events,
+		AnthropicSSEEvent{Event: "message_delta", Data: string(delta)},
+		AnthropicSSEEvent{Event: "message_stop", Data: `{"type":"message_stop"}`},
+	)
+
+	return events, nil
+}
+
+// AnthropicSSEEvent is one `event:`/`data:` pair of an Anthropic SSE stream.
+type AnthropicSSEEvent struct {
+	Event string
+	Data  string
+}
+
+// OpenAIToAnthropicStream translates an OpenAI chat.completion.chunk SSE
+// stream into Anthropic /v1/messages SSE events, the reverse of
+// AnthropicToOpenAIStream. Create one per request; feed it every OpenAI
+// "data:" payload in order via Translate.
+type OpenAIToAnthropicStream struct {
+	started     bool
+	textStarted bool
+	toolBlocks  map[int]int // openai tool_calls[] index -> anthropic content-block index
+	nextBlock   int
+}
+
+// NewOpenAIToAnthropicStream returns a ready-to-use translator.
+func NewOpenAIToAnthropicStream() *OpenAIToAnthropicStream {
+	return &OpenAIToAnthropicStream{toolBlocks: make(map[int]int)}
+}
+
+// Translate consumes one OpenAI SSE "data:" payload and returns the
+// Anthropic SSE events it produces, if any. The payload "[DONE]" signals
+// the end of the stream.
+func (s *OpenAIToAnthropicStream) Translate(data []byte) ([]AnthropicSSEEvent, error) {
+	if string(data) == "[DONE]" {
+		events := s.closeOpenBlocks()
+		events = append(events, AnthropicSSEEvent{Event: "message_stop", Data: `{"type":"message_stop"}`})
+		return events, nil
+	}
+
+	var chunk openAIStreamChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil, err
+	}
+	if len(chunk.Choices) == 0 {
+		return nil, nil
+	}
+	choice := chunk.Choices[0]
+
+	var events []AnthropicSSEEvent
+	if !s.started {
+		s.started = true
+		b, _ := json.Marshal(map[string]any{
+			"type": "message_start",
+			"message": map[string]any{
+				"id": chunk.ID, "type": "message", "role": "assistant", "model": chunk.Model,
+				"content": []any{}, "stop_reason": nil,
+				"usage": map[string]int{"input_tokens": 0, "output_tokens": 0},
+			},
+		})
+		events = append(events, AnthropicSSEEvent{Event: "message_start", Data: string(b)})
+	}
+
+	if choice.Delta.Content != "" {
+		if !s.textStarted {
+			s.textStarted = true
+			b, _ := json.Marshal(map[string]any{
+				"type": "content_block_start", "index": 0,
+				"content_block": map[string]string{"type": "text", "text": ""},
+			})
+			events = append(events, AnthropicSSEEvent{Event: "content_block_start", Data: string(b)})
+		}
+		b, _ := json.Marshal(map[string]any{
+			"type": "content_block_delta", "index": 0,
+			"delta": map[string]string{"type": "text_delta", "text": choice.Delta.Content},
+		})
+		events = append(events, AnthropicSSEEvent{Event: "content_block_delta", Data: string(b)})
+	}
+
+	for _, tc := range choice.Delta.ToolCalls {
+		idx, ok := s.toolBlocks[tc.Index]
+		if !ok {
+			idx = s.nextBlock
+			s.nextBlock++
+			s.toolBlocks[tc.Index] = idx
+			name := ""
+			if tc.Function != nil {
+				name = tc.Function.Name
+			}
+			b, _ := json.Marshal(map[string]any{
+				"type": "content_block_start", "index": idx,
+				"content_block": map[string]any{"type": "tool_use", "id": tc.ID, "name": name, "input": map[string]any{}},
+			})
+			events = append(events, AnthropicSSEEvent{Event: "content_block_start", Data: string(b)})
+		}
+		if tc.Function != nil && tc.Function.Arguments != "" {
+			b, _ := json.Marshal(map[string]any{
+				"type": "content_block_delta", "index": idx,
+				"delta": map[string]string{"type": "input_json_delta", "partial_json": tc.Function.Arguments},
+			})
+			events = append(events, AnthropicSSEEvent{Event: "content_block_delta", Data: string(b)})
+		}
+	}
+
+	if choice.FinishReason != nil {
+		events = append(events, s.closeOpenBlocks()...)
+		b, _ := json.Marshal(map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]string{"stop_reason": finishReasonToStopReason(*choice.FinishReason)},
+			"usage": map[string]int{"output_tokens": 0},
+		})
+		events = append(events, AnthropicSSEEvent{Event: "message_delta", Data: string(b)})
+	}
+
+	return events, nil
+}
+
+// closeOpenBlocks emits content_block_stop for every block opened so far,
+// in ascending index order, and resets tracking so a later call is a no-op.
+func (s *OpenAIToAnthropicStream) closeOpenBlocks() []AnthropicSSEEvent {
+	indices := make([]int, 0, len(s.toolBlocks)+1)
+	if s.textStarted {
+		indices = append(indices, 0)
+	}
+	for _, idx := range s.toolBlocks {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+
+	events := make([]AnthropicSSEEvent, 0, len(indices))
+	for _, idx := range indices {
+		b, _ := json.Marshal(map[string]any{"type": "content_block_stop", "index": idx})
+		events = append(events, AnthropicSSEEvent{Event: "content_block_stop", Data: string(b)})
+	}
+
+	s.textStarted = false
+	s.toolBlocks = make(map[int]int)
+	return events
+}
@@ -0,0 +1,155 @@
+package translate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestAnthropicToOpenAIStreamShape feeds a minimal Anthropic SSE stream
+// through AnthropicToOpenAIStream and checks every emitted payload is a
+// valid chat.completion.chunk: object "chat.completion.chunk" and a
+// choices[0].delta, never choices[0].message.
+func TestAnthropicToOpenAIStreamShape(t *testing.T) {
+	s := NewAnthropicToOpenAIStream()
+	events := []struct {
+		event string
+		data  string
+	}{
+		{"message_start", `{"message":{"id":"msg_1","model":"claude-3-opus"}}`},
+		{"content_block_delta", `{"index":0,"delta":{"type":"text_delta","text":"hi"}}`},
+		{"message_delta", `{"delta":{"stop_reason":"end_turn"}}`},
+		{"message_stop", `{}`},
+	}
+
+	for _, e := range events {
+		outs, err := s.Translate(e.event, []byte(e.data))
+		if err != nil {
+			t.Fatalf("Translate(%q): %v", e.event, err)
+		}
+		for _, o := range outs {
+			if o == "[DONE]" {
+				continue
+			}
+			assertValidOpenAIChunk(t, o)
+		}
+	}
+}
+
+// assertValidOpenAIChunk decodes data as a chat.completion.chunk and fails
+// if it looks like a completed chat.completion object instead (the
+// verbatim-replay bug this guards against).
+func assertValidOpenAIChunk(t *testing.T, data string) {
+	t.Helper()
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		t.Fatalf("invalid JSON chunk %s: %v", data, err)
+	}
+
+	var object string
+	if err := json.Unmarshal(raw["object"], &object); err != nil {
+		t.Fatalf("chunk has no object field: %s", data)
+	}
+	if object != "chat.completion.chunk" {
+		t.Errorf("object = %q, want %q", object, "chat.completion.chunk")
+	}
+
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(raw["choices"], &choices); err != nil || len(choices) == 0 {
+		t.Fatalf("chunk has no choices: %s", data)
+	}
+	if _, ok := choices[0]["delta"]; !ok {
+		t.Errorf("choices[0] has no delta field (streaming clients expect delta, not message): %s", data)
+	}
+	if _, ok := choices[0]["message"]; ok {
+		t.Errorf("choices[0] has a message field: a streaming chunk must not echo a completed message object: %s", data)
+	}
+}
+
+// TestReplayOpenAIStream checks that replaying a cached non-streaming
+// chat.completion as a stream produces valid chat.completion.chunk
+// payloads, not the stored completion object verbatim.
+func TestReplayOpenAIStream(t *testing.T) {
+	cached := []byte(`{
+		"id": "chatcmpl-1",
+		"object": "chat.completion",
+		"created": 1700000000,
+		"model": "gpt-4o",
+		"choices": [{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],
+		"usage": {"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}
+	}`)
+
+	chunks, err := ReplayOpenAIStream(cached)
+	if err != nil {
+		t.Fatalf("ReplayOpenAIStream: %v", err)
+	}
+	if len(chunks) == 0 {
+		t.Fatal("no chunks produced")
+	}
+	if chunks[len(chunks)-1] != "[DONE]" {
+		t.Errorf("last chunk = %q, want [DONE]", chunks[len(chunks)-1])
+	}
+
+	var sawContent bool
+	for _, c := range chunks[:len(chunks)-1] {
+		assertValidOpenAIChunk(t, c)
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(c), &chunk); err != nil {
+			t.Fatalf("decode chunk: %v", err)
+		}
+		if chunk.Choices[0].Delta.Content == "hello" {
+			sawContent = true
+		}
+	}
+	if !sawContent {
+		t.Error("no chunk carried the cached content as a delta")
+	}
+}
+
+// TestReplayAnthropicStream checks that replaying a cached non-streaming
+// message as a stream produces a valid message_start event with a nested
+// "message" object, not the stored completion echoed as message_start's
+// data directly.
+func TestReplayAnthropicStream(t *testing.T) {
+	cached := []byte(`{
+		"id": "msg_1",
+		"model": "claude-3-opus",
+		"role": "assistant",
+		"content": [{"type":"text","text":"hello"}],
+		"stop_reason": "end_turn",
+		"usage": {"input_tokens":1,"output_tokens":1}
+	}`)
+
+	events, err := ReplayAnthropicStream(cached)
+	if err != nil {
+		t.Fatalf("ReplayAnthropicStream: %v", err)
+	}
+	if len(events) == 0 {
+		t.Fatal("no events produced")
+	}
+	if events[0].Event != "message_start" {
+		t.Fatalf("first event = %q, want message_start", events[0].Event)
+	}
+
+	var start struct {
+		Type    string `json:"type"`
+		Message struct {
+			ID   string `json:"id"`
+			Role string `json:"role"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(events[0].Data), &start); err != nil {
+		t.Fatalf("decode message_start data: %v", err)
+	}
+	if start.Type != "message_start" {
+		t.Errorf("message_start data.type = %q, want %q", start.Type, "message_start")
+	}
+	if start.Message.ID != "msg_1" {
+		t.Errorf("message_start data.message.id = %q, want %q", start.Message.ID, "msg_1")
+	}
+
+	if events[len(events)-1].Event != "message_stop" {
+		t.Errorf("last event = %q, want message_stop", events[len(events)-1].Event)
+	}
+}
@@ -0,0 +1,230 @@
+// Package translate converts chat-completion requests and responses
+// between the OpenAI Chat Completions format and the Anthropic Messages
+// format, so a client speaking one API can be proxied to a backend
+// speaking the other. Both directions are covered: ToAnthropic and the
+// FromAnthropic* functions for an OpenAI client hitting an Anthropic-backed
+// model, and ToOpenAI and the FromOpenAI* functions for the reverse.
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultMaxTokens is used when an OpenAI request omits max_tokens, which
+// Anthropic requires.
+const defaultMaxTokens = 4096
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	MaxTokens   *int            `json:"max_tokens,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	Tools       []openAITool    `json:"tools,omitempty"`
+	ToolChoice  json.RawMessage `json:"tool_choice,omitempty"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+type openAIToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  json.RawMessage    `json:"tool_choice,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
+}
+
+type anthropicContent struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema,omitempty"`
+}
+
+// ToAnthropic converts an OpenAI /v1/chat/completions request body into an
+// Anthropic /v1/messages request body.
+func ToAnthropic(body []byte) ([]byte, error) {
+	var req openAIRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("translate: decode openai request: %w", err)
+	}
+
+	out := anthropicRequest{
+		Model:       req.Model,
+		Temperature: req.Temperature,
+		Stream:      req.Stream,
+	}
+
+	if req.MaxTokens != nil {
+		out.MaxTokens = *req.MaxTokens
+	} else {
+		out.MaxTokens = defaultMaxTokens
+	}
+
+	merged := mergeConsecutiveRoles(req.Messages)
+	var systemParts []string
+	for _, m := range merged {
+		if m.Role == "system" {
+			// Anthropic only accepts user/assistant roles in messages, so
+			// every system message - not just the first - is folded into
+			// the top-level system field instead of leaking through.
+			systemParts = append(systemParts, m.Content)
+			continue
+		}
+		out.Messages = append(out.Messages, openAIMessageToAnthropic(m))
+	}
+	out.System = strings.Join(systemParts, "\n")
+
+	for _, t := range req.Tools {
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: t.Function.Parameters,
+		})
+	}
+
+	if len(req.ToolChoice) > 0 {
+		if isOpenAIToolChoiceNone(req.ToolChoice) {
+			// Anthropic's tool_choice.type has no "none": the only way to
+			// disable tool use is to not offer any tools.
+			out.Tools = nil
+		} else {
+			out.ToolChoice = openAIToolChoiceToAnthropic(req.ToolChoice)
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// mergeConsecutiveRoles joins consecutive messages that share the same
+// role into one, concatenating their text content with a newline. A
+// message carrying tool_calls or a tool_call_id is never merged into the
+// one before it.
+func mergeConsecutiveRoles(messages []openAIMessage) []openAIMessage {
+	var merged []openAIMessage
+	for _, m := range messages {
+		if n := len(merged); n > 0 && merged[n-1].Role == m.Role && len(m.ToolCalls) == 0 && m.ToolCallID == "" {
+			merged[n-1].Content = merged[n-1].Content + "\n" + m.Content
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+func openAIMessageToAnthropic(m openAIMessage) anthropicMessage {
+	role := m.Role
+	var content []anthropicContent
+
+	switch {
+	case m.Role == "tool":
+		role = "user"
+		content = append(content, anthropicContent{
+			Type:      "tool_result",
+			ToolUseID: m.ToolCallID,
+			Content:   m.Content,
+		})
+	case len(m.ToolCalls) > 0:
+		if m.Content != "" {
+			content = append(content, anthropicContent{Type: "text", Text: m.Content})
+		}
+		for _, tc := range m.ToolCalls {
+			content = append(content, anthropicContent{
+				Type:  "tool_use",
+				ID:    tc.ID,
+				Name:  tc.Function.Name,
+				Input: json.RawMessage(orEmptyObject(tc.Function.Arguments)),
+			})
+		}
+	default:
+		content = append(content, anthropicContent{Type: "text", Text: m.Content})
+	}
+
+	return anthropicMessage{Role: role, Content: content}
+}
+
+func orEmptyObject(s string) string {
+	if s == "" {
+		return "{}"
+	}
+	return s
+}
+
+// isOpenAIToolChoiceNone reports whether raw is OpenAI's tool_choice:"none",
+// which Anthropic has no equivalent type for.
+func isOpenAIToolChoiceNone(raw json.RawMessage) bool {
+	var asString string
+	return json.Unmarshal(raw, &asString) == nil && asString == "none"
+}
+
+func openAIToolChoiceToAnthropic(raw json.RawMessage) json.RawMessage {
+	var asString string
+	if err := json.Unmarshal(raw, &asString); err == nil {
+		switch asString {
+		case "required":
+			return json.RawMessage(`{"type":"any"}`)
+		default:
+			return json.RawMessage(`{"type":"auto"}`)
+		}
+	}
+
+	var named struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err == nil && named.Function.Name != "" {
+		b, _ := json.Marshal(map[string]string{"type": "tool", "name": named.Function.Name})
+		return b
+	}
+
+	return json.RawMessage(`{"type":"auto"}`)
+}
@@ -0,0 +1,93 @@
+package translate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToAnthropicToolChoiceNone(t *testing.T) {
+	body := []byte(`{
+		"model": "gpt-4o",
+		"messages": [{"role": "user", "content": "hi"}],
+		"tools": [{"type": "function", "function": {"name": "lookup"}}],
+		"tool_choice": "none"
+	}`)
+
+	out, err := ToAnthropic(body)
+	if err != nil {
+		t.Fatalf("ToAnthropic: %v", err)
+	}
+
+	var req anthropicRequest
+	if err := json.Unmarshal(out, &req); err != nil {
+		t.Fatalf("decode translated request: %v", err)
+	}
+	if len(req.Tools) != 0 {
+		t.Errorf("Tools = %v, want empty: Anthropic has no tool_choice.type for \"none\", so tools must be dropped instead", req.Tools)
+	}
+	if len(req.ToolChoice) != 0 {
+		t.Errorf("ToolChoice = %s, want omitted", req.ToolChoice)
+	}
+}
+
+func TestToAnthropicFoldsEveryNonConsecutiveSystemMessage(t *testing.T) {
+	body := []byte(`{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "system", "content": "be concise"},
+			{"role": "user", "content": "hi"},
+			{"role": "system", "content": "always answer in French"},
+			{"role": "user", "content": "bye"}
+		]
+	}`)
+
+	out, err := ToAnthropic(body)
+	if err != nil {
+		t.Fatalf("ToAnthropic: %v", err)
+	}
+
+	var req anthropicRequest
+	if err := json.Unmarshal(out, &req); err != nil {
+		t.Fatalf("decode translated request: %v", err)
+	}
+	if want := "be concise\nalways answer in French"; req.System != want {
+		t.Errorf("System = %q, want %q", req.System, want)
+	}
+	for _, m := range req.Messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			t.Errorf("messages contains role %q: Anthropic only accepts user/assistant", m.Role)
+		}
+	}
+}
+
+func TestToAnthropicToolChoiceRequired(t *testing.T) {
+	body := []byte(`{
+		"model": "gpt-4o",
+		"messages": [{"role": "user", "content": "hi"}],
+		"tools": [{"type": "function", "function": {"name": "lookup"}}],
+		"tool_choice": "required"
+	}`)
+
+	out, err := ToAnthropic(body)
+	if err != nil {
+		t.Fatalf("ToAnthropic: %v", err)
+	}
+
+	var req anthropicRequest
+	if err := json.Unmarshal(out, &req); err != nil {
+		t.Fatalf("decode translated request: %v", err)
+	}
+	if len(req.Tools) != 1 {
+		t.Errorf("Tools = %v, want 1 entry preserved", req.Tools)
+	}
+
+	var tc struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(req.ToolChoice, &tc); err != nil {
+		t.Fatalf("decode tool_choice: %v", err)
+	}
+	if tc.Type != "any" {
+		t.Errorf("tool_choice.type = %q, want %q", tc.Type, "any")
+	}
+}
@@ -0,0 +1,207 @@
+// Package usage extracts prompt/completion token counts, and the full
+// completion content, from both non-streaming and streaming upstream
+// responses, in either the OpenAI or Anthropic response shape.
+package usage
+
+import (
+	"bytes"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Usage is the token accounting for one proxied request.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// ToolCall is one tool invocation accumulated from a streaming response's
+// deltas.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// Completion is the full text/tool-call content accumulated from a
+// streaming response, in the same shape as a non-streaming response from
+// the same backend, so it can be reassembled into one and cached.
+type Completion struct {
+	ID    string
+	Model string
+	// Content is the concatenated text of the response.
+	Content   string
+	ToolCalls []ToolCall
+	// FinishReason is the backend's own vocabulary: OpenAI's finish_reason
+	// ("stop", "tool_calls", ...) or Anthropic's stop_reason ("end_turn",
+	// "tool_use", ...), whichever the stream being observed speaks.
+	FinishReason string
+}
+
+// ExtractNonStreaming parses prompt/completion token counts out of a
+// complete JSON response body.
+func ExtractNonStreaming(body []byte, anthropic bool) Usage {
+	if anthropic {
+		return Usage{
+			PromptTokens:     int(gjson.GetBytes(body, "usage.input_tokens").Int()),
+			CompletionTokens: int(gjson.GetBytes(body, "usage.output_tokens").Int()),
+		}
+	}
+	return Usage{
+		PromptTokens:     int(gjson.GetBytes(body, "usage.prompt_tokens").Int()),
+		CompletionTokens: int(gjson.GetBytes(body, "usage.completion_tokens").Int()),
+	}
+}
+
+// InjectIncludeUsage sets OpenAI's stream_options.include_usage:true on a
+// streaming request body if it isn't already present, since the proxy
+// needs that trailing usage chunk to do token accounting.
+func InjectIncludeUsage(body []byte) ([]byte, error) {
+	if gjson.GetBytes(body, "stream_options.include_usage").Exists() {
+		return body, nil
+	}
+	return sjson.SetBytes(body, "stream_options.include_usage", true)
+}
+
+// StreamExtractor accumulates usage totals and the full completion content
+// from a streaming response as its raw SSE lines are relayed to the
+// client. It understands OpenAI's trailing `data: {...,"usage":{...}}`
+// chunk and delta/tool_calls shape, and Anthropic's message_start,
+// content_block_start/delta, and message_delta events.
+type StreamExtractor struct {
+	anthropic bool
+	result    Usage
+
+	id           string
+	model        string
+	content      string
+	toolCalls    []ToolCall
+	toolIndex    map[int]int // provider's block/tool_calls index -> toolCalls[] slot
+	finishReason string
+}
+
+// NewStreamExtractor returns an extractor for an Anthropic or OpenAI
+// streaming response, per anthropic.
+func NewStreamExtractor(anthropic bool) *StreamExtractor {
+	return &StreamExtractor{anthropic: anthropic}
+}
+
+// Observe inspects one raw SSE "data:" line from the upstream, before any
+// client-format translation, and folds any usage and completion content it
+// carries into the running totals.
+func (e *StreamExtractor) Observe(line []byte) {
+	data := bytes.TrimSpace(bytes.TrimPrefix(bytes.TrimSpace(line), []byte("data:")))
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+
+	if e.anthropic {
+		switch gjson.GetBytes(data, "type").String() {
+		case "message_start":
+			e.id = gjson.GetBytes(data, "message.id").String()
+			e.model = gjson.GetBytes(data, "message.model").String()
+			// Anthropic puts the prompt token count on message_start's
+			// message.usage.input_tokens; message_delta only ever carries
+			// output_tokens.
+			if in := gjson.GetBytes(data, "message.usage.input_tokens"); in.Exists() {
+				e.result.PromptTokens = int(in.Int())
+			}
+		case "content_block_start":
+			if gjson.GetBytes(data, "content_block.type").String() == "tool_use" {
+				e.startToolCall(
+					int(gjson.GetBytes(data, "index").Int()),
+					gjson.GetBytes(data, "content_block.id").String(),
+					gjson.GetBytes(data, "content_block.name").String(),
+				)
+			}
+		case "content_block_delta":
+			idx := int(gjson.GetBytes(data, "index").Int())
+			switch gjson.GetBytes(data, "delta.type").String() {
+			case "text_delta":
+				e.content += gjson.GetBytes(data, "delta.text").String()
+			case "input_json_delta":
+				e.appendToolArguments(idx, gjson.GetBytes(data, "delta.partial_json").String())
+			}
+		case "message_delta":
+			if out := gjson.GetBytes(data, "usage.output_tokens"); out.Exists() {
+				e.result.CompletionTokens = int(out.Int())
+			}
+			if sr := gjson.GetBytes(data, "delta.stop_reason"); sr.Exists() {
+				e.finishReason = sr.String()
+			}
+		}
+		return
+	}
+
+	if id := gjson.GetBytes(data, "id"); id.Exists() {
+		e.id = id.String()
+	}
+	if model := gjson.GetBytes(data, "model"); model.Exists() {
+		e.model = model.String()
+	}
+	if u := gjson.GetBytes(data, "usage"); u.Exists() {
+		e.result.PromptTokens = int(u.Get("prompt_tokens").Int())
+		e.result.CompletionTokens = int(u.Get("completion_tokens").Int())
+	}
+
+	choice := gjson.GetBytes(data, "choices.0")
+	if !choice.Exists() {
+		return
+	}
+	e.content += choice.Get("delta.content").String()
+	for _, tc := range choice.Get("delta.tool_calls").Array() {
+		idx := int(tc.Get("index").Int())
+		e.startToolCall(idx, tc.Get("id").String(), tc.Get("function.name").String())
+		if args := tc.Get("function.arguments"); args.Exists() {
+			e.appendToolArguments(idx, args.String())
+		}
+	}
+	if fr := choice.Get("finish_reason"); fr.Exists() && fr.String() != "" {
+		e.finishReason = fr.String()
+	}
+}
+
+// startToolCall records a new tool call at the backend's idx the first
+// time it's seen, a no-op on later deltas for the same idx.
+func (e *StreamExtractor) startToolCall(idx int, id, name string) {
+	if e.toolIndex == nil {
+		e.toolIndex = make(map[int]int)
+	}
+	if _, ok := e.toolIndex[idx]; ok {
+		return
+	}
+	e.toolIndex[idx] = len(e.toolCalls)
+	e.toolCalls = append(e.toolCalls, ToolCall{ID: id, Name: name})
+}
+
+// appendToolArguments appends an argument-JSON fragment to the tool call at
+// the backend's idx, if one has been started.
+func (e *StreamExtractor) appendToolArguments(idx int, args string) {
+	slot, ok := e.toolIndex[idx]
+	if !ok {
+		return
+	}
+	e.toolCalls[slot].Arguments += args
+}
+
+// Usage returns the token totals accumulated so far.
+func (e *StreamExtractor) Usage() Usage {
+	return e.result
+}
+
+// Completion returns the completion content accumulated so far, and false
+// if no chunk carrying an id was observed (e.g. an empty or failed
+// stream).
+func (e *StreamExtractor) Completion() (Completion, bool) {
+	if e.id == "" {
+		return Completion{}, false
+	}
+	return Completion{
+		ID:           e.id,
+		Model:        e.model,
+		Content:      e.content,
+		ToolCalls:    e.toolCalls,
+		FinishReason: e.finishReason,
+	}, true
+}
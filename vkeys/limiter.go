@@ -0,0 +1,128 @@
+package vkeys
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket refilled continuously at capacity/60 tokens per
+// second, so it enforces a per-minute rate without a fixed-window reset.
+type bucket struct {
+	mu         sync.Mutex
+	capacity   float64
+	tokens     float64
+	refillRate float64 // tokens per second
+	updated    time.Time
+}
+
+func newBucket(perMinute int) *bucket {
+	return &bucket{
+		capacity:   float64(perMinute),
+		tokens:     float64(perMinute),
+		refillRate: float64(perMinute) / 60,
+		updated:    time.Now(),
+	}
+}
+
+// refill credits tokens accrued since the last access, capped at capacity.
+// Callers must hold b.mu.
+func (b *bucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.updated).Seconds() * b.refillRate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.updated = now
+}
+
+// allow reports whether n tokens can be consumed right now, consuming them
+// if so.
+func (b *bucket) allow(n float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// positive reports whether the bucket currently holds any tokens, without
+// consuming any.
+func (b *bucket) positive() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	return b.tokens > 0
+}
+
+// charge deducts n tokens unconditionally, letting the balance go negative
+// when n exceeds what's available. A request recorded after the fact can
+// overrun the budget; going negative means the key stays blocked until the
+// deficit refills instead of the overrun going unpunished.
+func (b *bucket) charge(n float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens -= n
+}
+
+// Limiter enforces per-key requests-per-minute and tokens-per-minute caps.
+type Limiter struct {
+	mu  sync.Mutex
+	rpm map[string]*bucket
+	tpm map[string]*bucket
+}
+
+// NewLimiter returns an empty Limiter; buckets are created lazily per key.
+func NewLimiter() *Limiter {
+	return &Limiter{rpm: make(map[string]*bucket), tpm: make(map[string]*bucket)}
+}
+
+// AllowRequest consumes one request against key's RPM budget. A key with no
+// RPM configured is unlimited.
+func (l *Limiter) AllowRequest(key *Key) bool {
+	if key.RPM <= 0 {
+		return true
+	}
+	return l.bucketFor(l.rpm, key.Key, key.RPM).allow(1)
+}
+
+// AllowTokens reports whether key currently has a positive TPM budget,
+// without consuming from it; call ChargeTokens once the request's actual
+// usage is known. A key with no TPM configured is unlimited.
+func (l *Limiter) AllowTokens(key *Key) bool {
+	if key.TPM <= 0 {
+		return true
+	}
+	return l.bucketFor(l.tpm, key.Key, key.TPM).positive()
+}
+
+// ChargeTokens deducts n tokens from key's TPM budget once a request
+// completes and its actual usage is known. A key with no TPM configured is
+// a no-op.
+func (l *Limiter) ChargeTokens(key *Key, n int) {
+	if key.TPM <= 0 {
+		return
+	}
+	l.bucketFor(l.tpm, key.Key, key.TPM).charge(float64(n))
+}
+
+// bucketFor returns id's bucket in set, creating it lazily, and recreates
+// it (refilled to full) whenever ratePerMinute no longer matches the
+// bucket's capacity — e.g. after an admin updates the key's RPM/TPM — so a
+// rotated limit takes effect without a process restart.
+func (l *Limiter) bucketFor(set map[string]*bucket, id string, ratePerMinute int) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := set[id]
+	if !ok || b.capacity != float64(ratePerMinute) {
+		b = newBucket(ratePerMinute)
+		set[id] = b
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+package vkeys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowRequestEnforcesRPM(t *testing.T) {
+	l := NewLimiter()
+	key := &Key{Key: "k1", RPM: 2}
+
+	if !l.AllowRequest(key) {
+		t.Fatal("expected first request to be allowed")
+	}
+	if !l.AllowRequest(key) {
+		t.Fatal("expected second request to be allowed")
+	}
+	if l.AllowRequest(key) {
+		t.Error("expected third request to exceed a 2 RPM budget")
+	}
+}
+
+func TestAllowRequestUnlimitedWhenRPMUnset(t *testing.T) {
+	l := NewLimiter()
+	key := &Key{Key: "k1"}
+
+	for i := 0; i < 100; i++ {
+		if !l.AllowRequest(key) {
+			t.Fatalf("request %d should be allowed when RPM is unset", i)
+		}
+	}
+}
+
+func TestAllowTokensDoesNotConsume(t *testing.T) {
+	l := NewLimiter()
+	key := &Key{Key: "k1", TPM: 100}
+
+	for i := 0; i < 10; i++ {
+		if !l.AllowTokens(key) {
+			t.Fatalf("AllowTokens() should not itself deplete the budget, call %d", i)
+		}
+	}
+}
+
+func TestChargeTokensBlocksFutureRequestsOnOverrun(t *testing.T) {
+	l := NewLimiter()
+	key := &Key{Key: "k1", TPM: 100}
+
+	if !l.AllowTokens(key) {
+		t.Fatal("expected budget to start positive")
+	}
+	l.ChargeTokens(key, 150)
+
+	if l.AllowTokens(key) {
+		t.Error("expected AllowTokens to report false once a charge pushes the bucket negative")
+	}
+}
+
+func TestChargeTokensUnlimitedWhenTPMUnset(t *testing.T) {
+	l := NewLimiter()
+	key := &Key{Key: "k1"}
+
+	l.ChargeTokens(key, 1_000_000)
+	if !l.AllowTokens(key) {
+		t.Error("a key with no TPM configured should stay unlimited regardless of charges")
+	}
+}
+
+func TestBucketForRecreatesBucketWhenRateChanges(t *testing.T) {
+	l := NewLimiter()
+	key := &Key{Key: "k1", TPM: 10}
+
+	l.ChargeTokens(key, 20)
+	if l.AllowTokens(key) {
+		t.Fatal("expected the 10 TPM bucket to be driven negative by a 20-token charge")
+	}
+
+	// Simulate an admin raising the key's TPM budget; bucketFor should
+	// recreate the bucket at the new capacity instead of carrying over the
+	// exhausted balance until the process restarts.
+	key.TPM = 1000
+	if !l.AllowTokens(key) {
+		t.Error("expected a live TPM increase to take effect immediately, without a restart")
+	}
+}
+
+func TestBucketAllowRefillsOverTime(t *testing.T) {
+	b := newBucket(60) // 1 token/second
+	if !b.allow(60) {
+		t.Fatal("expected to drain the full bucket")
+	}
+	if b.allow(1) {
+		t.Fatal("expected bucket to be empty immediately after draining it")
+	}
+
+	b.updated = b.updated.Add(-2 * time.Second) // pretend 2 seconds elapsed
+	if !b.allow(1) {
+		t.Error("expected the bucket to have refilled after the elapsed time")
+	}
+}
@@ -0,0 +1,189 @@
+// Package vkeys implements virtual API keys: per-key model allow-lists,
+// expiry, and cumulative spend, backed by a pluggable Store so budgets
+// survive restarts.
+package vkeys
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Key is one virtual API key and the policy attached to it.
+type Key struct {
+	Key           string     `json:"key" yaml:"key"`
+	AllowedModels []string   `json:"allowed_models,omitempty" yaml:"allowed_models,omitempty"`
+	RPM           int        `json:"rpm,omitempty" yaml:"rpm,omitempty"`
+	TPM           int        `json:"tpm,omitempty" yaml:"tpm,omitempty"`
+	MaxBudgetUSD  float64    `json:"max_budget_usd,omitempty" yaml:"max_budget_usd,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+}
+
+// Expired reports whether the key is past its configured expiry.
+func (k *Key) Expired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+// AllowsModel reports whether k may be used against model. An empty
+// allow-list permits every model.
+func (k *Key) AllowsModel(model string) bool {
+	if len(k.AllowedModels) == 0 {
+		return true
+	}
+	for _, m := range k.AllowedModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists virtual keys and their cumulative spend.
+type Store interface {
+	Get(key string) (*Key, bool)
+	Put(k *Key) error
+	Delete(key string) error
+	List() []*Key
+	AddSpend(key string, usd float64) (float64, error)
+	Spend(key string) float64
+}
+
+// MemoryStore is an in-memory Store; restarting the process resets spend.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	keys  map[string]*Key
+	spend map[string]float64
+}
+
+// NewMemoryStore returns an empty in-memory Store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]*Key), spend: make(map[string]float64)}
+}
+
+func (s *MemoryStore) Get(key string) (*Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[key]
+	return k, ok
+}
+
+func (s *MemoryStore) Put(k *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.Key] = k
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	delete(s.spend, key)
+	return nil
+}
+
+func (s *MemoryStore) List() []*Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		out = append(out, k)
+	}
+	return out
+}
+
+func (s *MemoryStore) AddSpend(key string, usd float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spend[key] += usd
+	return s.spend[key], nil
+}
+
+func (s *MemoryStore) Spend(key string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.spend[key]
+}
+
+// fileSnapshot is the on-disk representation a FileStore persists.
+type fileSnapshot struct {
+	Keys  []*Key             `json:"keys"`
+	Spend map[string]float64 `json:"spend"`
+}
+
+// FileStore is a Store backed by an in-memory MemoryStore that is
+// snapshotted to a JSON file on every mutation, so budgets and keys survive
+// a restart.
+type FileStore struct {
+	*MemoryStore
+	path      string
+	writeLock sync.Mutex
+}
+
+// NewFileStore loads path if it exists, or starts empty, and returns a
+// Store that persists every mutation back to path.
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fs, nil
+		}
+		return nil, fmt.Errorf("vkeys: read store file: %w", err)
+	}
+
+	var snap fileSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("vkeys: decode store file: %w", err)
+	}
+	for _, k := range snap.Keys {
+		fs.MemoryStore.keys[k.Key] = k
+	}
+	for key, v := range snap.Spend {
+		fs.MemoryStore.spend[key] = v
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Put(k *Key) error {
+	if err := fs.MemoryStore.Put(k); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+func (fs *FileStore) Delete(key string) error {
+	if err := fs.MemoryStore.Delete(key); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+func (fs *FileStore) AddSpend(key string, usd float64) (float64, error) {
+	total, err := fs.MemoryStore.AddSpend(key, usd)
+	if err != nil {
+		return total, err
+	}
+	return total, fs.persist()
+}
+
+func (fs *FileStore) persist() error {
+	fs.writeLock.Lock()
+	defer fs.writeLock.Unlock()
+
+	keys := fs.MemoryStore.List()
+	snap := fileSnapshot{Keys: keys, Spend: make(map[string]float64, len(keys))}
+	for _, k := range keys {
+		snap.Spend[k.Key] = fs.MemoryStore.Spend(k.Key)
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("vkeys: encode store file: %w", err)
+	}
+	return os.WriteFile(fs.path, data, 0o600)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+
+	"github.com/phosae/llmp/metrics"
+	"github.com/phosae/llmp/usage"
+)
+
+// wsPingPeriod is how often the server pings an open WebSocket stream to
+// keep it alive through idle corporate proxies.
+const wsPingPeriod = 20 * time.Second
+
+var wsUpgrader = websocket.Upgrader{
+	// Browsers that can't set custom headers authenticate over
+	// "Sec-WebSocket-Protocol: bearer, <token>" instead; authMiddleware has
+	// already resolved and checked that token by the time Upgrade runs, so
+	// "bearer" is the only subprotocol we need to be willing to select.
+	Subprotocols: []string{"bearer"},
+	CheckOrigin:  func(r *http.Request) bool { return true },
+}
+
+// wsConn serializes writes to a *websocket.Conn, since gorilla/websocket
+// allows only one concurrent writer and this endpoint has two: the stream
+// relay and the keepalive ping loop.
+type wsConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (c *wsConn) writeMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(messageType, data)
+}
+
+func (c *wsConn) writeControl(messageType int, data []byte, deadline time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteControl(messageType, data, deadline)
+}
+
+// wsSink is the StreamSink backing the WebSocket streaming endpoints. It
+// forwards each upstream SSE "data:" payload as its own frame: text for
+// JSON chunks, binary for anything else.
+type wsSink struct {
+	conn *wsConn
+}
+
+func (s *wsSink) WriteEvent(line []byte) error {
+	payload, ok := sseDataPayload(line)
+	if !ok {
+		return nil
+	}
+
+	msgType := websocket.BinaryMessage
+	if json.Valid(payload) {
+		msgType = websocket.TextMessage
+	}
+	return s.conn.writeMessage(msgType, payload)
+}
+
+func (s *wsSink) Flush() {}
+
+// sseDataPayload extracts the payload carried by an SSE "data:" line, or
+// the data: portion of a multi-line "event: ...\ndata: ...\n\n" block. ok
+// is false for lines that carry no payload (event: lines, blank
+// keep-alives, and so on).
+func sseDataPayload(line []byte) (payload []byte, ok bool) {
+	for _, l := range bytes.Split(line, []byte("\n")) {
+		l = bytes.TrimSpace(l)
+		rest := bytes.TrimPrefix(l, []byte("data:"))
+		if len(rest) == len(l) {
+			continue
+		}
+		if rest = bytes.TrimSpace(rest); len(rest) > 0 {
+			return rest, true
+		}
+	}
+	return nil, false
+}
+
+// wsChatCompletionsHandler upgrades to a WebSocket and streams an OpenAI
+// chat completion the way /v1/chat/completions does over SSE.
+func wsChatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
+	handleWebSocketStream(w, r, formatOpenAI)
+}
+
+// wsMessagesHandler upgrades to a WebSocket and streams an Anthropic
+// message the way /v1/messages does over SSE.
+func wsMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	handleWebSocketStream(w, r, formatAnthropic)
+}
+
+// handleWebSocketStream upgrades the connection, reads the request body
+// from the client's first text frame, then proxies and streams the
+// completion back as WebSocket frames instead of SSE.
+func handleWebSocketStream(w http.ResponseWriter, r *http.Request, clientFmt requestFormat) {
+	start := time.Now()
+	metrics.Inflight.Inc()
+	defer metrics.Inflight.Dec()
+
+	upgraded, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	conn := &wsConn{conn: upgraded}
+	defer upgraded.Close()
+
+	vk := virtualKeyFromContext(r)
+
+	_, body, err := upgraded.ReadMessage()
+	if err != nil {
+		log.Printf("Error reading WebSocket request frame: %v", err)
+		return
+	}
+
+	modelName := gjson.GetBytes(body, "model").String()
+	if modelName == "" {
+		wsCloseWithError(conn, "model field is required")
+		return
+	}
+	if !modelRouter.Exists(modelName) {
+		wsCloseWithError(conn, "model not found")
+		return
+	}
+	if vk != nil && !vk.AllowsModel(modelName) {
+		wsCloseWithError(conn, "model not allowed for this key")
+		return
+	}
+
+	// Cancelling the upstream request on client close, rather than letting
+	// it run to completion, is the only way to stop a dispatch that's
+	// already past the point of being retried elsewhere.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go watchForClientClose(upgraded, cancel)
+
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go pingLoop(conn, stopPing)
+
+	// The /ws route is this proxy's own; upstream is dialed on the plain
+	// endpoint for the client's format.
+	upstreamPath := "/v1/chat/completions"
+	if clientFmt == formatAnthropic {
+		upstreamPath = "/v1/messages"
+	}
+	resp, dep, err := dispatch(ctx, modelName, upstreamPath, body, clientFmt, true)
+	ttfb := time.Since(start)
+	if err != nil {
+		metrics.UpstreamErrorsTotal.WithLabelValues(modelName).Inc()
+		wsCloseWithError(conn, "all deployments failed: "+err.Error())
+		logAccess(accessLogEntry{
+			Model:        modelName,
+			VirtualKeyID: virtualKeyID(vk),
+			TTFBMs:       ttfb.Milliseconds(),
+			TotalMs:      time.Since(start).Milliseconds(),
+			Status:       http.StatusBadGateway,
+		})
+		return
+	}
+	defer dep.Release()
+	defer resp.Body.Close()
+
+	backendFmt := backendFormat(dep.Params.Model)
+	translating := clientFmt != backendFmt
+
+	sink := &wsSink{conn: conn}
+	extractor := usage.NewStreamExtractor(backendFmt == formatAnthropic)
+	switch {
+	case translating && backendFmt == formatAnthropic:
+		streamAnthropicToOpenAI(resp.Body, sink, extractor)
+	case translating:
+		streamOpenAIToAnthropic(resp.Body, sink, extractor)
+	default:
+		streamPassthrough(resp.Body, sink, extractor)
+	}
+
+	tokenUsage := extractor.Usage()
+	recordUsage(vk, dep, tokenUsage)
+
+	metrics.RequestsTotal.WithLabelValues(modelName, dep.Params.Model, strconv.Itoa(resp.StatusCode)).Inc()
+	metrics.TokensTotal.WithLabelValues(modelName, "prompt").Add(float64(tokenUsage.PromptTokens))
+	metrics.TokensTotal.WithLabelValues(modelName, "completion").Add(float64(tokenUsage.CompletionTokens))
+	metrics.RequestDuration.WithLabelValues(modelName).Observe(time.Since(start).Seconds())
+
+	logAccess(accessLogEntry{
+		Model:        modelName,
+		Deployment:   dep.Params.Model,
+		VirtualKeyID: virtualKeyID(vk),
+		TokensIn:     tokenUsage.PromptTokens,
+		TokensOut:    tokenUsage.CompletionTokens,
+		TTFBMs:       ttfb.Milliseconds(),
+		TotalMs:      time.Since(start).Milliseconds(),
+		Status:       resp.StatusCode,
+	})
+
+	conn.writeControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+}
+
+// watchForClientClose cancels cancel as soon as the client closes the
+// connection or it errors out, so an in-flight upstream request is
+// abandoned instead of streamed to no one.
+func watchForClientClose(conn *websocket.Conn, cancel context.CancelFunc) {
+	defer cancel()
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// pingLoop sends a WebSocket ping every wsPingPeriod to keep the connection
+// alive through idle proxies, until stop is closed.
+func pingLoop(conn *wsConn, stop <-chan struct{}) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.writeControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// wsCloseWithError sends a JSON error frame and then a 1011 close, per the
+// endpoint's contract for a failure that happens after the upgrade.
+func wsCloseWithError(conn *wsConn, message string) {
+	payload, _ := json.Marshal(map[string]string{"error": message})
+	if err := conn.writeMessage(websocket.TextMessage, payload); err != nil {
+		log.Printf("Error writing WebSocket error frame: %v", err)
+	}
+	conn.writeControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseInternalServerErr, message),
+		time.Now().Add(time.Second))
+}